@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/google/uuid"
+)
+
+type ModerationItem struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ChirpID     uuid.UUID  `json:"chirp_id"`
+	Source      string     `json:"source"`
+	Reason      string     `json:"reason"`
+	ReportCount int32      `json:"report_count"`
+	Status      string     `json:"status"`
+	ResolvedAt  *time.Time `json:"resolved_at"`
+	Hidden      bool       `json:"hidden"`
+}
+
+func newModerationItem(item database.ModerationQueue) ModerationItem {
+	result := ModerationItem{
+		ID:          item.ID,
+		CreatedAt:   item.CreatedAt,
+		UpdatedAt:   item.UpdatedAt,
+		ChirpID:     item.PostID,
+		Source:      item.Source,
+		Reason:      item.Reason,
+		ReportCount: item.ReportCount,
+		Status:      item.Status,
+		Hidden:      item.Hidden,
+	}
+
+	if item.ResolvedAt.Valid {
+		result.ResolvedAt = &item.ResolvedAt.Time
+	}
+
+	return result
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID       `json:"id"`
+	EventID     *string         `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	Status      string          `json:"status"`
+	Error       *string         `json:"error"`
+	Attempts    int32           `json:"attempts"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+	ClaimedAt   time.Time       `json:"claimed_at"`
+}
+
+func newWebhookEvent(event database.WebhookEvent) WebhookEvent {
+	result := WebhookEvent{
+		ID:         event.ID,
+		EventType:  event.EventType,
+		Payload:    event.Payload,
+		ReceivedAt: event.ReceivedAt,
+		Status:     event.Status,
+		Attempts:   event.Attempts,
+		ClaimedAt:  event.ClaimedAt,
+	}
+
+	if event.EventID.Valid {
+		result.EventID = &event.EventID.String
+	}
+
+	if event.Error.Valid {
+		result.Error = &event.Error.String
+	}
+
+	if event.ProcessedAt.Valid {
+		result.ProcessedAt = &event.ProcessedAt.Time
+	}
+
+	return result
+}
+
+func (cfg *apiConfig) handleRestorePost(w http.ResponseWriter, r *http.Request) {
+	postUUID, err := uuid.Parse(r.PathValue("chirpID"))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR  couldn't parse string", err)
+		return
+	}
+
+	result, err := cfg.dbQueries.RestorePost(r.Context(), postUUID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't restore the post", err)
+		return
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR  checking affected rows", err)
+		return
+	}
+
+	if rowsAffected == 0 {
+		respondWithError(w, http.StatusNotFound, "ERROR  POST WAS NOT FOUND OR NOT DELETED", nil)
+		return
+	}
+
+	post, err := cfg.dbQueries.GetPost(r.Context(), postUUID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't get the post", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Post{
+		ID:        post.ID,
+		CreatedAt: post.CreatedAt,
+		UpdatedAt: post.UpdatedAt,
+		Body:      post.Body,
+		UserID:    post.UserID,
+	})
+}
+
+func (cfg *apiConfig) handleListModeration(w http.ResponseWriter, r *http.Request) {
+	type returnItem struct {
+		ModerationItem
+		Chirp struct {
+			Body   string    `json:"body"`
+			UserID uuid.UUID `json:"user_id"`
+		} `json:"chirp"`
+	}
+
+	status := r.URL.Query().Get("status")
+
+	switch status {
+	case "":
+		status = moderationPending
+	case moderationPending, moderationApproved, moderationRemoved:
+	default:
+		respondWithError(w, http.StatusBadRequest, "ERROR status must be pending, approved or removed", nil)
+		return
+	}
+
+	items, err := cfg.dbQueries.ListModerationItems(r.Context(), status)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't get the moderation queue", err)
+		return
+	}
+
+	returnItems := []returnItem{}
+
+	for _, item := range items {
+		returnValue := returnItem{
+			ModerationItem: newModerationItem(database.ModerationQueue{
+				ID:          item.ID,
+				CreatedAt:   item.CreatedAt,
+				UpdatedAt:   item.UpdatedAt,
+				PostID:      item.PostID,
+				Source:      item.Source,
+				Reason:      item.Reason,
+				ReporterID:  item.ReporterID,
+				ReportCount: item.ReportCount,
+				Status:      item.Status,
+				ResolvedAt:  item.ResolvedAt,
+				Hidden:      item.Hidden,
+			}),
+		}
+		returnValue.Chirp.Body = item.PostBody
+		returnValue.Chirp.UserID = item.PostUserID
+
+		returnItems = append(returnItems, returnValue)
+	}
+
+	respondWithJSON(w, http.StatusOK, returnItems)
+}
+
+func (cfg *apiConfig) handleApproveModeration(w http.ResponseWriter, r *http.Request) {
+	cfg.resolveModeration(w, r, moderationApproved)
+}
+
+func (cfg *apiConfig) handleRemoveModeration(w http.ResponseWriter, r *http.Request) {
+	cfg.resolveModeration(w, r, moderationRemoved)
+}
+
+// resolveModeration closes a pending queue item. Removing also soft deletes
+// the chirp so it can still be restored later.
+func (cfg *apiConfig) resolveModeration(w http.ResponseWriter, r *http.Request, status string) {
+	itemUUID, err := uuid.Parse(r.PathValue("itemID"))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR  couldn't parse string", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	item, err := queries.ResolveModerationItem(r.Context(), database.ResolveModerationItemParams{
+		Status: status,
+		ID:     itemUUID,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "ERROR  ITEM WAS NOT FOUND OR ALREADY RESOLVED", err)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't resolve the item", err)
+		return
+	}
+
+	if status == moderationRemoved {
+		_, err = queries.RemovePost(r.Context(), item.PostID)
+
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "ERROR couldn't remove the post", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't resolve the item", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newModerationItem(item))
+}
+
+func (cfg *apiConfig) handleListWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+
+	switch status {
+	case "":
+		status = webhookFailed
+	case webhookPending, webhookProcessed, webhookIgnored, webhookFailed:
+	default:
+		respondWithError(w, http.StatusBadRequest, "ERROR status must be pending, processed, ignored or failed", nil)
+		return
+	}
+
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR invalid limit", err)
+		return
+	}
+
+	events, err := cfg.dbQueries.ListWebhookEvents(r.Context(), database.ListWebhookEventsParams{
+		Status: status,
+		Limit:  int32(limit),
+	})
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't get the webhook events", err)
+		return
+	}
+
+	returnEvents := []WebhookEvent{}
+
+	for _, event := range events {
+		returnEvents = append(returnEvents, newWebhookEvent(event))
+	}
+
+	respondWithJSON(w, http.StatusOK, returnEvents)
+}
+
+// handleReplayWebhookEvent applies a failed event again, for example after
+// the cause of the failure was fixed, or one left pending for longer than
+// webhookClaimTimeout. The response shows how it went.
+func (cfg *apiConfig) handleReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	eventUUID, err := uuid.Parse(r.PathValue("eventID"))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR  couldn't parse string", err)
+		return
+	}
+
+	event, err := cfg.dbQueries.RetryWebhookEvent(r.Context(), database.RetryWebhookEventParams{
+		ID:                  eventUUID,
+		ClaimTimeoutSeconds: webhookClaimTimeout.Seconds(),
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "ERROR  EVENT WAS NOT FOUND, DIDN'T FAIL OR IS STILL BEING PROCESSED", err)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't replay the event", err)
+		return
+	}
+
+	payload := polkaEvent{}
+	err = json.Unmarshal(event.Payload, &payload)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't decode the stored event", err)
+		return
+	}
+
+	err = cfg.processPolkaEvent(r.Context(), event.ID, payload, event.ReceivedAt)
+
+	if err != nil {
+		log.Printf("Replaying webhook event %s failed again: %s", event.ID, err)
+	}
+
+	event, err = cfg.dbQueries.GetWebhookEvent(r.Context(), event.ID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't get the event", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, newWebhookEvent(event))
+}
@@ -1,10 +1,19 @@
 package main
 
 import (
+	"context"
 	"github.com/FallenL3vi/WebServer/internal/auth"
 	"testing"
 	"time"
 	"github.com/google/uuid"
+	"github.com/golang-jwt/jwt/v5"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
 )
 
 func TestHash(t *testing.T) {
@@ -31,7 +40,7 @@ func TestCheckHash(t *testing.T) {
 
 func TestValidJWT(t *testing.T) {
 	userID := uuid.New()
-	validToken, _ := auth.MakeJWT(userID, "secret", time.Hour)
+	validToken, _ := auth.MakeJWT(userID, auth.RoleUser, "secret", time.Hour)
 
 	tests := []struct {
 		name string
@@ -75,4 +84,188 @@ func TestValidJWT(t *testing.T) {
 			}
 		}) 
 	}
-}
\ No newline at end of file
+}
+
+func TestJWTRole(t *testing.T) {
+	userID := uuid.New()
+	token, _ := auth.MakeJWT(userID, auth.RoleModerator, "secret", time.Hour)
+
+	claims, err := auth.ParseJWT(token, "secret")
+
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+
+	if claims.Role != auth.RoleModerator || claims.Subject != userID.String() {
+		t.Errorf("ParseJWT() role = %v subject = %v", claims.Role, claims.Subject)
+	}
+}
+
+func writeKey(t *testing.T, dir, id string, key any) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	os.WriteFile(filepath.Join(dir, id+".pem"), pemBytes, 0o600)
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	writeKey(t, dir, "2025-01", rsaKey)
+	writeKey(t, dir, "2025-02", edKey)
+
+	oldKeys, err := auth.LoadKeySet(dir, "2025-01", "")
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+
+	userID := uuid.New()
+	oldToken, _ := oldKeys.MakeJWT(auth.AccessToken{UserID: userID, Role: auth.RoleUser}, time.Hour)
+
+	// The newest key signs by default, tokens from the previous key stay valid
+	keys, err := auth.LoadKeySet(dir, "", "")
+	if err != nil {
+		t.Fatalf("LoadKeySet() error = %v", err)
+	}
+
+	newToken, _ := keys.MakeJWT(auth.AccessToken{UserID: userID, Role: auth.RoleUser}, time.Hour)
+
+	for _, token := range []string{oldToken, newToken} {
+		gotUserID, err := keys.ValidateJWT(token)
+		if err != nil || gotUserID != userID {
+			t.Errorf("ValidateJWT() = %v, %v", gotUserID, err)
+		}
+	}
+
+	parsed, _, _ := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	if parsed.Header["kid"] != "2025-02" || parsed.Method.Alg() != "EdDSA" {
+		t.Errorf("new token header = %v", parsed.Header)
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].KeyType != "RSA" || jwks.Keys[1].Curve != "Ed25519" {
+		t.Errorf("JWKS() = %+v", jwks)
+	}
+
+	// HS256 tokens are only accepted when the legacy secret is configured
+	legacyToken, _ := auth.MakeJWT(userID, auth.RoleUser, "secret", time.Hour)
+	if _, err := keys.ValidateJWT(legacyToken); err == nil {
+		t.Errorf("ValidateJWT() accepted an HS256 token")
+	}
+
+	withLegacy, _ := auth.LoadKeySet(dir, "", "secret")
+	if _, err := withLegacy.ValidateJWT(legacyToken); err != nil {
+		t.Errorf("ValidateJWT() legacy token error = %v", err)
+	}
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	token, _ := auth.MakeRefreshToken()
+
+	hash := auth.HashRefreshToken(token)
+
+	if hash == token || len(hash) != 64 {
+		t.Errorf("HashRefreshToken() = %q", hash)
+	}
+
+	if auth.HashRefreshToken(token) != hash {
+		t.Errorf("HashRefreshToken() isn't deterministic")
+	}
+}
+
+func TestJWTSessionID(t *testing.T) {
+	keys := auth.NewKeySet(auth.NewHMACKey("", "secret"))
+	sessionID := uuid.New()
+
+	token, _ := keys.MakeJWT(auth.AccessToken{UserID: uuid.New(), Role: auth.RoleUser, SessionID: sessionID}, time.Hour)
+	claims, err := keys.ParseJWT(token)
+
+	if err != nil || claims.SessionID != sessionID.String() {
+		t.Errorf("ParseJWT() sid = %q, %v", claims.SessionID, err)
+	}
+
+	token, _ = keys.MakeJWT(auth.AccessToken{UserID: uuid.New(), Role: auth.RoleUser}, time.Hour)
+	claims, _ = keys.ParseJWT(token)
+
+	if claims.SessionID != "" {
+		t.Errorf("ParseJWT() sid = %q, want none", claims.SessionID)
+	}
+}
+
+func TestTokenVersionCache(t *testing.T) {
+	userID := uuid.New()
+	loads := 0
+	stored := int32(1)
+
+	cache := auth.NewTokenVersionCache(time.Minute, func(ctx context.Context, id uuid.UUID) (int32, error) {
+		loads++
+		return stored, nil
+	})
+
+	for range 3 {
+		version, err := cache.Get(context.Background(), userID)
+		if err != nil || version != 1 {
+			t.Fatalf("Get() = %v, %v", version, err)
+		}
+	}
+
+	if loads != 1 {
+		t.Errorf("Get() loaded the version %d times, want 1", loads)
+	}
+
+	// A bump on this server is visible right away
+	stored = 2
+	cache.Set(userID, 2)
+
+	if version, _ := cache.Get(context.Background(), userID); version != 2 || loads != 1 {
+		t.Errorf("Get() after Set() = %v, loads = %d", version, loads)
+	}
+}
+
+func TestTokenVersionCacheKeepsNewerVersion(t *testing.T) {
+	userID := uuid.New()
+	var cache *auth.TokenVersionCache
+
+	// The password changes while Get is still loading the old version
+	cache = auth.NewTokenVersionCache(time.Minute, func(ctx context.Context, id uuid.UUID) (int32, error) {
+		cache.Set(userID, 2)
+		return 1, nil
+	})
+
+	cache.Get(context.Background(), userID)
+
+	if version, _ := cache.Get(context.Background(), userID); version != 2 {
+		t.Errorf("Get() = %d after a racing Set(2), want 2", version)
+	}
+
+	cache.Set(userID, 1)
+
+	if version, _ := cache.Get(context.Background(), userID); version != 2 {
+		t.Errorf("Get() = %d after Set() of an older version, want 2", version)
+	}
+}
+
+func TestJWTVersionAndID(t *testing.T) {
+	keys := auth.NewKeySet(auth.NewHMACKey("", "secret"))
+	userID := uuid.New()
+
+	first, _ := keys.MakeJWT(auth.AccessToken{UserID: userID, Role: auth.RoleUser, Version: 3}, time.Hour)
+	second, _ := keys.MakeJWT(auth.AccessToken{UserID: userID, Role: auth.RoleUser, Version: 3}, time.Hour)
+
+	firstClaims, err := keys.ParseJWT(first)
+	if err != nil {
+		t.Fatalf("ParseJWT() error = %v", err)
+	}
+	secondClaims, _ := keys.ParseJWT(second)
+
+	if firstClaims.Version != 3 {
+		t.Errorf("ParseJWT() ver = %d, want 3", firstClaims.Version)
+	}
+
+	if firstClaims.ID == "" || firstClaims.ID == secondClaims.ID {
+		t.Errorf("ParseJWT() jti = %q and %q, want unique IDs", firstClaims.ID, secondClaims.ID)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/FallenL3vi/WebServer/internal/database"
+)
+
+const usage = `usage:
+  out                        start the server
+  out promote-admin <email>  give an existing user the admin role`
+
+func runCommand(ctx context.Context, queries *database.Queries, args []string) error {
+	switch args[0] {
+	case "promote-admin":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		return promoteAdmin(ctx, queries, args[1])
+	}
+
+	return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+}
+
+// promoteAdmin is how the first admin is created, later ones can be
+// promoted the same way
+func promoteAdmin(ctx context.Context, queries *database.Queries, email string) error {
+	result, err := queries.SetUserRoleByEmail(ctx, database.SetUserRoleByEmailParams{
+		Role:  auth.RoleAdmin,
+		Email: email,
+	})
+
+	if err != nil {
+		return fmt.Errorf("couldn't promote %s: %w", email, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("no user with email %s", email)
+	}
+
+	fmt.Printf("%s is now an admin, the role applies to access tokens issued from now on\n", email)
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/config"
+)
+
+func TestConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "chirpy.yaml")
+	envFile := filepath.Join(dir, ".env")
+
+	os.WriteFile(configFile, []byte("db_url: postgres://file/chirpy\naddr: :7000\nread_timeout: 3s\npolka_key: from-file\n"), 0o600)
+	os.WriteFile(envFile, []byte("ADDR=:7001\nSECRET_JWT=0123456789abcdef0123456789abcdef\nTOTP_ENCRYPTION_KEY=MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=\nPLATFORM=dev\n"), 0o600)
+	t.Setenv("POLKA_KEY", "from-env")
+
+	conf, args, err := config.Load([]string{"-config", configFile, "-env-file", envFile, "-read-timeout", "4s", "promote-admin", "a@b.c"})
+
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if conf.DBURL != "postgres://file/chirpy" || conf.Addr != ":7001" || conf.PolkaKey != "from-env" || conf.ReadTimeout != 4*time.Second {
+		t.Errorf("Load() = %+v", conf)
+	}
+
+	if len(args) != 2 || args[0] != "promote-admin" {
+		t.Errorf("Load() args = %v", args)
+	}
+}
+
+func TestConfigFileLists(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "chirpy.yaml")
+
+	os.WriteFile(configFile, []byte(`db_url: postgres://file/chirpy
+platform: dev
+secret_jwt: 0123456789abcdef0123456789abcdef
+polka_key: key
+totp_encryption_key: MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=
+trusted_proxies:
+  - 10.0.0.0/8
+  - 192.0.2.1
+rate_limits: ["POST /api/login=5/10s", "GET /api/chirps=100/10s"]
+`), 0o600)
+
+	conf, _, err := config.Load([]string{"-config", configFile, "-env-file", filepath.Join(dir, "missing")})
+
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(conf.TrustedProxies) != 2 || conf.TrustedProxies[1].String() != "192.0.2.1/32" {
+		t.Errorf("TrustedProxies = %v", conf.TrustedProxies)
+	}
+
+	if conf.RateLimits["POST /api/login"].String() != "5/10s" || conf.RateLimits["GET /api/chirps"].String() != "100/10s" {
+		t.Errorf("RateLimits = %v", conf.RateLimits)
+	}
+
+	os.WriteFile(configFile, []byte("rate_limits:\n  POST /api/login: 5/1m\n"), 0o600)
+
+	_, _, err = config.Load([]string{"-config", configFile, "-env-file", filepath.Join(dir, "missing")})
+
+	if err == nil || !strings.Contains(err.Error(), "nested maps") {
+		t.Errorf("Load() error = %v, want nested maps to be rejected", err)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	_, _, err := config.Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing"), "-db-url", "mysql://x", "-secret-jwt", "short", "-purge-interval", "0s", "-reports-to-hide", "0"})
+
+	if err == nil {
+		t.Fatal("Load() expected error")
+	}
+
+	for _, want := range []string{"DB_URL", "SECRET_JWT", "POLKA_KEY", "TOTP_ENCRYPTION_KEY", "PURGE_INTERVAL", "MAIL_DIR", "REPORTS_TO_HIDE"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error %q doesn't mention %s", err, want)
+		}
+	}
+}
+
+func TestConfigRateLimits(t *testing.T) {
+	t.Setenv("DB_URL", "postgres://localhost/chirpy")
+	t.Setenv("SECRET_JWT", "0123456789abcdef0123456789abcdef")
+	t.Setenv("POLKA_KEY", "key")
+	t.Setenv("TOTP_ENCRYPTION_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	t.Setenv("MAIL_DIR", t.TempDir())
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1")
+	t.Setenv("RATE_LIMITS", "POST /api/chirps=5/1m, GET /api/chirps=100/10s")
+
+	conf, _, err := config.Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing")})
+
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(conf.TrustedProxies) != 2 || conf.TrustedProxies[1].String() != "192.0.2.1/32" {
+		t.Errorf("TrustedProxies = %v", conf.TrustedProxies)
+	}
+
+	if len(conf.RateLimits) != 2 || conf.RateLimits["GET /api/chirps"].String() != "100/10s" {
+		t.Errorf("RateLimits = %v", conf.RateLimits)
+	}
+
+	t.Setenv("RATE_LIMITS", "POST /api/chirps")
+	t.Setenv("TRUSTED_PROXIES", "proxy.local")
+
+	_, _, err = config.Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing")})
+
+	for _, want := range []string{"RATE_LIMITS", "TRUSTED_PROXIES"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error %v doesn't mention %s", err, want)
+		}
+	}
+}
@@ -1,83 +1,68 @@
 package auth
 
 import (
-	"golang.org/x/crypto/bcrypt"
 	"github.com/google/uuid"
 	"time"
 	"errors"
-	"fmt"
 	"strings"
 	"github.com/golang-jwt/jwt/v5"
 	"net/http"
 	"crypto/rand"
 	"encoding/hex"
+	"crypto/sha256"
 )
 
 type TokenType string
 const (
 	TokenTypeAccess TokenType = "chirpy-access"
+	TokenTypeMFA TokenType = "chirpy-mfa"
 )
 
+// HashPassword hashes with Argon2id and the default parameters, see
+// PasswordHasher for other parameters
 func HashPassword(password string) (string, error) {
- hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-
- if err != nil {
-	return "", err
- }
-
- return string(hashed), nil
+	hasher := PasswordHasher{Params: DefaultArgon2Params()}
+	return hasher.Hash(password)
 }
 
+// CheckPasswordHash accepts Argon2id and bcrypt hashes
 func CheckPasswordHash(hash, password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-
-	return err
+	hasher := PasswordHasher{Params: DefaultArgon2Params()}
+	return hasher.Check(hash, password)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
-		IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
-		Issuer: string(TokenTypeAccess),
-		Subject: userID.String(),
-	})
+// Roles a user can have, stored in users.role and embedded in access tokens
+const (
+	RoleUser = "user"
+	RoleModerator = "moderator"
+	RoleAdmin = "admin"
+)
 
-	return token.SignedString([]byte(tokenSecret))
+type Claims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role,omitempty"`
+	// SessionID is the family ID of the refresh token the access token
+	// was issued with
+	SessionID string `json:"sid,omitempty"`
+	// Version is the token_version of the user when the token was issued,
+	// bumping it revokes every older access token
+	Version int32 `json:"ver"`
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	},)
-
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	userClaimsID, err := token.Claims.GetSubject()
-
-	if err != nil {
-		return uuid.Nil, err
-	}
-
-	issuer, err := token.Claims.GetIssuer()
-
-	if err != nil {
-		return uuid.Nil ,err
-	}
-
-	if issuer != string(TokenTypeAccess) {
-		return uuid.Nil, errors.New("invalid issuer")
-	}
-
-	id, err := uuid.Parse(userClaimsID)
+// MakeJWT signs an access token with a shared HS256 secret, see KeySet for
+// signing with rotating asymmetric keys
+func MakeJWT(userID uuid.UUID, role string, tokenSecret string, expiresIn time.Duration) (string, error) {
+	return NewKeySet(NewHMACKey("", tokenSecret)).MakeJWT(AccessToken{UserID: userID, Role: role}, expiresIn)
+}
 
-	if err != nil {
-		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
-	}
+// ParseJWT validates an access token signed with a shared HS256 secret and
+// returns all of its claims
+func ParseJWT(tokenString, tokenSecret string) (*Claims, error) {
+	return NewKeySet(NewHMACKey("", tokenSecret)).ParseJWT(tokenString)
+}
 
-	return id, nil
+func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	return NewKeySet(NewHMACKey("", tokenSecret)).ValidateJWT(tokenString)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -96,7 +81,9 @@ func GetBearerToken(headers http.Header) (string, error) {
 
 }
 
-func MakeRefreshToken() (string, error) {
+// MakeToken returns a random opaque token, such as the ones sent in
+// verification emails
+func MakeToken() (string, error) {
 
 	key := make([]byte, 32)
 	rand.Read(key)
@@ -106,6 +93,21 @@ func MakeRefreshToken() (string, error) {
 	return encodedStr, nil
 }
 
+func MakeRefreshToken() (string, error) {
+	return MakeToken()
+}
+
+// HashToken is the digest opaque tokens are stored and looked up by, the
+// token itself is only ever known to the client
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func HashRefreshToken(token string) string {
+	return HashToken(token)
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	header := headers.Get("Authorization")
 
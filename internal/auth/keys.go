@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const minRSAKeyBits = 2048
+
+// SigningKey is one key of a KeySet. Its ID is sent as the kid header of
+// every token it signs.
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+	// public is nil for HMAC keys, which are never published
+	public crypto.PublicKey
+}
+
+// NewHMACKey wraps a shared secret. Tokens signed with it carry no kid when
+// id is empty, like the tokens issued before key rotation existed.
+func NewHMACKey(id, secret string) *SigningKey {
+	return &SigningKey{
+		ID:     id,
+		Method: jwt.SigningMethodHS256,
+		sign:   []byte(secret),
+		verify: []byte(secret),
+	}
+}
+
+// NewSigningKey wraps an RSA (RS256) or Ed25519 (EdDSA) private key
+func NewSigningKey(id string, private crypto.PrivateKey) (*SigningKey, error) {
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("key %s: RSA keys need at least %d bits", id, minRSAKeyBits)
+		}
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, sign: key, verify: &key.PublicKey, public: &key.PublicKey}, nil
+	case ed25519.PrivateKey:
+		public := key.Public().(ed25519.PublicKey)
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, sign: key, verify: public, public: public}, nil
+	}
+
+	return nil, fmt.Errorf("key %s: unsupported key type %T, use RSA or Ed25519", id, private)
+}
+
+// KeySet signs access tokens with its active key and accepts tokens signed
+// by any of its keys. Rotate by adding a new key, making it active and
+// removing the old key once the tokens it signed have expired.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+func NewKeySet(active *SigningKey, others ...*SigningKey) *KeySet {
+	keySet := &KeySet{active: active, keys: map[string]*SigningKey{active.ID: active}}
+
+	for _, key := range others {
+		keySet.keys[key.ID] = key
+	}
+
+	return keySet
+}
+
+// LoadKeySet reads every *.pem file in dir as a PKCS#8 (or PKCS#1 RSA)
+// private key named after the file, e.g. 2025-06.pem has the kid 2025-06.
+// activeID picks the signing key, when it is empty the last kid in
+// alphabetical order is used. A non empty legacySecret keeps HS256 tokens
+// without a kid valid while clients move over.
+func LoadKeySet(dir, activeID, legacySecret string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no *.pem keys in %s", dir)
+	}
+
+	sort.Strings(paths)
+	keys := map[string]*SigningKey{}
+	ids := []string{}
+
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+
+		key, err := loadPrivateKey(path)
+
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+
+		signingKey, err := NewSigningKey(id, key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		keys[id] = signingKey
+		ids = append(ids, id)
+	}
+
+	if activeID == "" {
+		activeID = ids[len(ids)-1]
+	}
+
+	active, ok := keys[activeID]
+
+	if !ok {
+		return nil, fmt.Errorf("signing key %s not found in %s", activeID, dir)
+	}
+
+	others := []*SigningKey{}
+
+	for _, key := range keys {
+		others = append(others, key)
+	}
+
+	if legacySecret != "" {
+		others = append(others, NewHMACKey("", legacySecret))
+	}
+
+	return NewKeySet(active, others...), nil
+}
+
+func loadPrivateKey(path string) (crypto.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+// AccessToken holds what an access token says about its holder
+type AccessToken struct {
+	UserID uuid.UUID
+	Role   string
+	// SessionID is the refresh token family the token was issued for,
+	// uuid.Nil when the token isn't tied to a session
+	SessionID uuid.UUID
+	Version   int32
+}
+
+func (k *KeySet) MakeJWT(subject AccessToken, expiresIn time.Duration) (string, error) {
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			Issuer:    string(TokenTypeAccess),
+			Subject:   subject.UserID.String(),
+			ID:        uuid.NewString(),
+		},
+		Role:    subject.Role,
+		Version: subject.Version,
+	}
+
+	if subject.SessionID != uuid.Nil {
+		claims.SessionID = subject.SessionID.String()
+	}
+
+	return k.sign(claims)
+}
+
+// MakeMFAToken signs the token a login answers with when the user has two
+// factor authentication on. It proves the password was right and can only
+// be exchanged for an access token together with a second factor.
+func (k *KeySet) MakeMFAToken(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	return k.sign(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			Issuer:    string(TokenTypeMFA),
+			Subject:   userID.String(),
+			ID:        uuid.NewString(),
+		},
+	})
+}
+
+func (k *KeySet) sign(claims Claims) (string, error) {
+	token := jwt.NewWithClaims(k.active.Method, claims)
+
+	if k.active.ID != "" {
+		token.Header["kid"] = k.active.ID
+	}
+
+	return token.SignedString(k.active.sign)
+}
+
+// ParseJWT validates an access token and returns all of its claims
+func (k *KeySet) ParseJWT(tokenString string) (*Claims, error) {
+	return k.parse(tokenString, TokenTypeAccess)
+}
+
+// ParseMFAToken validates an MFA challenge token and returns its user
+func (k *KeySet) ParseMFAToken(tokenString string) (uuid.UUID, error) {
+	claims, err := k.parse(tokenString, TokenTypeMFA)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	return id, nil
+}
+
+// parse checks the signature, expiry and that the token is of tokenType,
+// so an MFA token is never accepted as an access token
+func (k *KeySet) parse(tokenString string, tokenType TokenType) (*Claims, error) {
+	claims := Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := k.keys[kid]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		// Never let the token pick the algorithm, that would allow signing
+		// HS256 tokens with a published RSA key as the secret
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+
+		return key.verify, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	issuer, err := token.Claims.GetIssuer()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if issuer != string(tokenType) {
+		return nil, errors.New("invalid issuer")
+	}
+
+	return &claims, nil
+}
+
+func (k *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims, err := k.ParseJWT(tokenString)
+
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+
+	return id, nil
+}
+
+// JWK is a public key in the JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS lists the public keys other services need to verify access tokens
+func (k *KeySet) JWKS() JWKS {
+	ids := []string{}
+
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, id := range ids {
+		key := k.keys[id]
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+// Argon2Params are the Argon2id cost settings, Memory is in KiB
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follows the second recommendation of RFC 9106 with a
+// smaller memory cost: 64 MiB, 3 passes
+func DefaultArgon2Params() Argon2Params {
+	return Argon2Params{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+// PasswordHasher hashes new passwords with Argon2id and checks both
+// Argon2id and bcrypt hashes, the algorithm is taken from the hash
+type PasswordHasher struct {
+	Params Argon2Params
+}
+
+// Hash returns the password hash in the PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+
+	_, err := rand.Read(salt)
+
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		h.Params.Memory,
+		h.Params.Iterations,
+		h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Check returns nil when password matches hash
+func (h *PasswordHasher) Check(hash, password string) error {
+	if strings.HasPrefix(hash, argon2idPrefix) {
+		params, salt, key, err := decodeArgon2id(hash)
+
+		if err != nil {
+			return err
+		}
+
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return errors.New("password doesn't match")
+		}
+
+		return nil
+	}
+
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	}
+
+	return errors.New("unknown password hash algorithm")
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or other
+// parameters than the hasher uses now. Passwords are only known at login,
+// so that's when old hashes can be replaced.
+func (h *PasswordHasher) NeedsRehash(hash string) bool {
+	params, salt, _, err := decodeArgon2id(hash)
+
+	if err != nil {
+		return true
+	}
+
+	params.SaltLength = uint32(len(salt))
+	return params != h.Params
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	invalid := errors.New("invalid argon2id hash")
+
+	// "", "argon2id", "v=19", "m=65536,t=3,p=2", salt, key
+	parts := strings.Split(hash, "$")
+
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, invalid
+	}
+
+	var version int
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, invalid
+	}
+
+	params := Argon2Params{}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2Params{}, nil, nil, invalid
+	}
+
+	// argon2.IDKey panics on these
+	if params.Iterations < 1 || params.Parallelism < 1 {
+		return Argon2Params{}, nil, nil, invalid
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+
+	if err != nil {
+		return Argon2Params{}, nil, nil, invalid
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, invalid
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
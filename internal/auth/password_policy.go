@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Argon2id takes passwords of any size, the limit only keeps hashing cheap
+const defaultMaxPasswordBytes = 256
+
+// PasswordPolicy decides which passwords users may choose
+type PasswordPolicy struct {
+	// MinLength counts characters, not bytes
+	MinLength int
+	MaxBytes  int
+	// MinClasses is how many of lower case letters, upper case letters,
+	// digits and symbols a password has to mix
+	MinClasses int
+	// Breached rejects known passwords when it isn't nil
+	Breached *BreachedPasswords
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: 8,
+		MaxBytes:  defaultMaxPasswordBytes,
+	}
+}
+
+// WeakPasswordError lists every rule a password breaks
+type WeakPasswordError struct {
+	Violations []string
+}
+
+func (e *WeakPasswordError) Error() string {
+	return "password " + strings.Join(e.Violations, ", ")
+}
+
+// Check returns a *WeakPasswordError when the password breaks any rule
+func (p PasswordPolicy) Check(password string) error {
+	violations := []string{}
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	if len(password) > p.MaxBytes {
+		violations = append(violations, fmt.Sprintf("must be at most %d bytes long", p.MaxBytes))
+	}
+
+	if p.MinClasses > 0 && characterClasses(password) < p.MinClasses {
+		violations = append(violations, fmt.Sprintf("must mix at least %d of lower case letters, upper case letters, digits and symbols", p.MinClasses))
+	}
+
+	if p.Breached != nil && p.Breached.Contains(password) {
+		violations = append(violations, "appears in a list of breached passwords")
+	}
+
+	if len(violations) > 0 {
+		return &WeakPasswordError{Violations: violations}
+	}
+
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	classes := 0
+
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			classes++
+		}
+	}
+
+	return classes
+}
+
+// BreachedPasswords is a set of SHA-1 password hashes, as published by
+// Have I Been Pwned. Only the hashes are kept in memory.
+type BreachedPasswords struct {
+	hashes map[[sha1.Size]byte]struct{}
+}
+
+// LoadBreachedPasswords reads a file with one upper or lower case hex SHA-1
+// hash per line, optionally followed by :count like the Pwned Passwords
+// downloads. Blank lines and lines starting with # are skipped.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	breached := &BreachedPasswords{hashes: map[[sha1.Size]byte]struct{}{}}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hexHash, _, _ := strings.Cut(line, ":")
+		var hash [sha1.Size]byte
+
+		if len(hexHash) != hex.EncodedLen(sha1.Size) {
+			return nil, fmt.Errorf("%s:%d: not a SHA-1 hash", path, lineNumber)
+		}
+
+		_, err := hex.Decode(hash[:], []byte(hexHash))
+
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: not a SHA-1 hash", path, lineNumber)
+		}
+
+		breached.hashes[hash] = struct{}{}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return breached, nil
+}
+
+func (b *BreachedPasswords) Contains(password string) bool {
+	_, ok := b.hashes[sha1.Sum([]byte(password))]
+	return ok
+}
+
+func (b *BreachedPasswords) Len() int {
+	return len(b.hashes)
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SecretKeySize is the size of a SecretBox key, AES-256
+const SecretKeySize = 32
+
+// sealedPrefix marks values sealed by a SecretBox, so plaintext stored
+// before encryption can be told apart
+const sealedPrefix = "v1:"
+
+// SecretBox encrypts secrets the server has to read back, such as TOTP
+// secrets, with AES-GCM before they are stored
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+// NewSecretBox returns a SecretBox with a key of SecretKeySize bytes
+func NewSecretBox(key []byte) (*SecretBox, error) {
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", SecretKeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretBox{aead: aead}, nil
+}
+
+// ParseSecretKey decodes a base64 encoded key of SecretKeySize bytes
+func ParseSecretKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+
+	if err != nil {
+		return nil, errors.New("key is not base64")
+	}
+
+	if len(key) != SecretKeySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", SecretKeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// Seal encrypts secret. The same associated data, e.g. the ID of the row
+// the value is stored in, has to be passed to Open, so a sealed value
+// can't be copied to another row.
+func (b *SecretBox) Seal(secret, associatedData string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+
+	_, err := rand.Read(nonce)
+
+	if err != nil {
+		return "", err
+	}
+
+	sealed := b.aead.Seal(nonce, nonce, []byte(secret), []byte(associatedData))
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value of Seal
+func (b *SecretBox) Open(sealed, associatedData string) (string, error) {
+	if !IsSealed(sealed) {
+		return "", errors.New("value is not sealed")
+	}
+
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(sealed, sealedPrefix))
+
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return "", errors.New("malformed sealed value")
+	}
+
+	nonce, ciphertext := data[:b.aead.NonceSize()], data[b.aead.NonceSize():]
+	secret, err := b.aead.Open(nil, nonce, ciphertext, []byte(associatedData))
+
+	if err != nil {
+		return "", errors.New("couldn't decrypt, wrong key or associated data")
+	}
+
+	return string(secret), nil
+}
+
+// IsSealed reports whether value came from Seal
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
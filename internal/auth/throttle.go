@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// ThrottlePolicy says how failed logins slow down further attempts. After
+// BackoffAfter failures every attempt has to wait BaseDelay, doubling with
+// each failure. After LockoutAfter failures attempts are refused for
+// LockoutDuration. Failures are forgotten LockoutDuration after the last one.
+type ThrottlePolicy struct {
+	BackoffAfter    int
+	LockoutAfter    int
+	BaseDelay       time.Duration
+	LockoutDuration time.Duration
+}
+
+// LoginThrottle counts failed logins per key, such as an email address or
+// a client IP. Counts live in memory, so every server keeps its own.
+//
+// Attempts are reserved with Acquire before the password is checked and end
+// with Fail, Reset or Release. Attempts still running count against the
+// thresholds, so parallel requests can't all get in before their failures
+// are counted.
+type LoginThrottle struct {
+	policy ThrottlePolicy
+
+	mu        sync.Mutex
+	failures  map[string]*failedAttempts
+	lastSweep time.Time
+}
+
+type failedAttempts struct {
+	count int
+	last  time.Time
+	// inFlight is the number of attempts acquired and not ended yet
+	inFlight int
+}
+
+func NewLoginThrottle(policy ThrottlePolicy) *LoginThrottle {
+	return &LoginThrottle{policy: policy, failures: map[string]*failedAttempts{}}
+}
+
+// Wait returns how long key has to wait before the next attempt, 0 when it
+// may try now
+func (t *LoginThrottle) Wait(key string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	attempts, ok := t.failures[key]
+
+	if !ok || now.Sub(attempts.last) > t.policy.LockoutDuration {
+		return 0
+	}
+
+	allowedAt := attempts.last.Add(t.delay(attempts.count))
+
+	if now.Before(allowedAt) {
+		return allowedAt.Sub(now)
+	}
+
+	return 0
+}
+
+// Acquire reserves an attempt of key. When key has to wait it returns how
+// long and false. Up to BackoffAfter attempts may run at once, past that
+// only one at a time, so each failure is counted before the next attempt.
+func (t *LoginThrottle) Acquire(key string, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now)
+
+	attempts := t.current(key, now)
+	wait := time.Duration(0)
+
+	if attempts.count > 0 {
+		wait = attempts.last.Add(t.delay(attempts.count)).Sub(now)
+	}
+
+	if wait <= 0 && attempts.inFlight > 0 && attempts.count+attempts.inFlight >= t.policy.BackoffAfter {
+		wait = t.policy.BaseDelay
+	}
+
+	if wait > 0 {
+		t.forget(key, attempts)
+		return wait, false
+	}
+
+	attempts.inFlight++
+	return 0, true
+}
+
+// Fail records a failed attempt, ends its reservation and returns the
+// number of failures in a row
+func (t *LoginThrottle) Fail(key string, now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now)
+
+	attempts := t.current(key, now)
+	attempts.count++
+	attempts.last = now
+
+	if attempts.inFlight > 0 {
+		attempts.inFlight--
+	}
+
+	return attempts.count
+}
+
+// Reset forgets the failures of key after a successful login and ends its
+// reservation
+func (t *LoginThrottle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	attempts, ok := t.failures[key]
+
+	if !ok {
+		return
+	}
+
+	attempts.count = 0
+
+	if attempts.inFlight > 0 {
+		attempts.inFlight--
+	}
+
+	t.forget(key, attempts)
+}
+
+// Release ends a reservation without counting a failure, for attempts that
+// ended before the password was checked or that succeeded without
+// resetting the failures of key
+func (t *LoginThrottle) Release(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	attempts, ok := t.failures[key]
+
+	if !ok {
+		return
+	}
+
+	if attempts.inFlight > 0 {
+		attempts.inFlight--
+	}
+
+	t.forget(key, attempts)
+}
+
+// current returns the attempts of key, failures that are forgotten already
+// start over
+func (t *LoginThrottle) current(key string, now time.Time) *failedAttempts {
+	attempts, ok := t.failures[key]
+
+	if !ok {
+		attempts = &failedAttempts{}
+		t.failures[key] = attempts
+	}
+
+	if attempts.count > 0 && now.Sub(attempts.last) > t.policy.LockoutDuration {
+		attempts.count = 0
+	}
+
+	return attempts
+}
+
+// forget drops key once it has neither failures nor attempts running
+func (t *LoginThrottle) forget(key string, attempts *failedAttempts) {
+	if attempts.count == 0 && attempts.inFlight == 0 {
+		delete(t.failures, key)
+	}
+}
+
+// Locked reports whether failures is enough for a lockout
+func (t *LoginThrottle) Locked(failures int) bool {
+	return failures >= t.policy.LockoutAfter
+}
+
+// BackingOff reports whether failures is enough to slow down attempts
+func (t *LoginThrottle) BackingOff(failures int) bool {
+	return failures >= t.policy.BackoffAfter
+}
+
+func (t *LoginThrottle) delay(failures int) time.Duration {
+	if failures >= t.policy.LockoutAfter {
+		return t.policy.LockoutDuration
+	}
+
+	if failures < t.policy.BackoffAfter {
+		return 0
+	}
+
+	delay := t.policy.BaseDelay
+
+	for range failures - t.policy.BackoffAfter {
+		delay *= 2
+
+		if delay >= t.policy.LockoutDuration {
+			return t.policy.LockoutDuration
+		}
+	}
+
+	return delay
+}
+
+// sweep drops keys whose failures are forgotten and that have no attempts
+// running, at most once per lockout duration
+func (t *LoginThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.policy.LockoutDuration {
+		return
+	}
+
+	for key, attempts := range t.failures {
+		if attempts.inFlight == 0 && now.Sub(attempts.last) > t.policy.LockoutDuration {
+			delete(t.failures, key)
+		}
+	}
+
+	t.lastSweep = now
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenVersionCache remembers the current token version of users so
+// checking access tokens doesn't hit the database on every request. A
+// version bumped by another server is noticed once the cached entry is
+// older than the TTL.
+type TokenVersionCache struct {
+	ttl  time.Duration
+	load func(ctx context.Context, userID uuid.UUID) (int32, error)
+
+	mu        sync.Mutex
+	versions  map[uuid.UUID]cachedVersion
+	lastSweep time.Time
+}
+
+type cachedVersion struct {
+	version   int32
+	expiresAt time.Time
+}
+
+func NewTokenVersionCache(ttl time.Duration, load func(ctx context.Context, userID uuid.UUID) (int32, error)) *TokenVersionCache {
+	return &TokenVersionCache{
+		ttl:      ttl,
+		load:     load,
+		versions: map[uuid.UUID]cachedVersion{},
+	}
+}
+
+// Get returns the current token version of the user
+func (c *TokenVersionCache) Get(ctx context.Context, userID uuid.UUID) (int32, error) {
+	c.mu.Lock()
+	cached, ok := c.versions[userID]
+	c.mu.Unlock()
+
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.version, nil
+	}
+
+	version, err := c.load(ctx, userID)
+
+	if err != nil {
+		return 0, err
+	}
+
+	c.Set(userID, version)
+	return version, nil
+}
+
+// Set stores a version the caller just bumped, so this server rejects the
+// old tokens right away instead of after the TTL
+func (c *TokenVersionCache) Set(userID uuid.UUID, version int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Dropping expired entries once per TTL keeps the map about as large
+	// as the number of users active within one TTL
+	now := time.Now()
+
+	if now.Sub(c.lastSweep) > c.ttl {
+		for id, cached := range c.versions {
+			if now.After(cached.expiresAt) {
+				delete(c.versions, id)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	// Versions only go up. A Get that loaded the version before a bump can
+	// finish after the bump was stored, it mustn't bring the old one back.
+	if cached, ok := c.versions[userID]; ok && cached.version > version {
+		return
+	}
+
+	c.versions[userID] = cachedVersion{version: version, expiresAt: now.Add(c.ttl)}
+}
@@ -0,0 +1,603 @@
+// Package config loads the server configuration.
+//
+// Every setting has an environment variable name, e.g. DB_URL. The same
+// setting is read from the config file under the lower case key (db_url)
+// and from the command line as a flag (-db-url). Later sources win:
+//
+//	defaults < config file < .env < environment < flags
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/FallenL3vi/WebServer/internal/plans"
+	"github.com/FallenL3vi/WebServer/internal/ratelimit"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	minSecretLength  = 32
+	maxPasswordBytes = 4096
+
+	postChirpsRoute = "POST /api/chirps"
+)
+
+type Config struct {
+	DBURL     string
+	Platform  string
+	SecretJWT string
+	PolkaKey  string
+
+	TOTPEncryptionKey string
+
+	JWTKeysDir      string
+	JWTSigningKeyID string
+	JWTAcceptHS256  bool
+
+	TokenVersionCacheTTL time.Duration
+
+	Addr              string
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	MaxHeaderBytes    int
+
+	ChirpRetention time.Duration
+	PurgeInterval  time.Duration
+
+	BannedWordsFile           string
+	BannedWordsReloadInterval time.Duration
+	ReportsToHide             int
+
+	PublicURL            string
+	MailFrom             string
+	SMTPAddr             string
+	SMTPUsername         string
+	SMTPPassword         string
+	MailDir              string
+	EmailVerificationTTL time.Duration
+	PasswordResetTTL     time.Duration
+	PasswordResetURL     string
+
+	PasswordMinLength     int
+	PasswordMaxBytes      int
+	PasswordMinClasses    int
+	BreachedPasswordsFile string
+
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
+
+	LoginAccountBackoffAfter int
+	LoginAccountLockoutAfter int
+	LoginIPBackoffAfter      int
+	LoginIPLockoutAfter      int
+	LoginBackoffBase         time.Duration
+	LoginLockoutDuration     time.Duration
+
+	TrustedProxies   []netip.Prefix
+	RateLimitDefault ratelimit.Limit
+	RateLimits       map[string]ratelimit.Limit
+
+	Plans                      plans.Table
+	SubscriptionExpiryInterval time.Duration
+}
+
+func defaults() Config {
+	return Config{
+		Addr:              ":8080",
+		ReadTimeout:       10 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		ShutdownTimeout:   15 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+
+		TokenVersionCacheTTL: 30 * time.Second,
+
+		ChirpRetention: 30 * 24 * time.Hour,
+		PurgeInterval:  time.Hour,
+
+		BannedWordsReloadInterval: time.Minute,
+		ReportsToHide:             3,
+
+		PublicURL:            "http://localhost:8080",
+		MailFrom:             "chirpy@localhost",
+		EmailVerificationTTL: 24 * time.Hour,
+		PasswordResetTTL:     time.Hour,
+
+		PasswordMinLength: 8,
+		PasswordMaxBytes:  256,
+
+		Argon2Memory:      64 * 1024,
+		Argon2Iterations:  3,
+		Argon2Parallelism: 2,
+
+		LoginAccountBackoffAfter: 3,
+		LoginAccountLockoutAfter: 10,
+		LoginIPBackoffAfter:      20,
+		LoginIPLockoutAfter:      100,
+		LoginBackoffBase:         time.Second,
+		LoginLockoutDuration:     15 * time.Minute,
+
+		RateLimitDefault: ratelimit.Limit{Requests: 120, Per: time.Minute},
+		RateLimits: map[string]ratelimit.Limit{
+			"POST /api/login": {Requests: 10, Per: time.Minute},
+		},
+
+		Plans:                      plans.DefaultTable(),
+		SubscriptionExpiryInterval: time.Minute,
+	}
+}
+
+type field struct {
+	env    string
+	usage  string
+	target func(c *Config) any
+}
+
+var fields = []field{
+	{"DB_URL", "PostgreSQL connection string", func(c *Config) any { return &c.DBURL }},
+	{"PLATFORM", `"dev" enables POST /admin/reset and logging emails`, func(c *Config) any { return &c.Platform }},
+	{"SECRET_JWT", "secret used to sign access tokens", func(c *Config) any { return &c.SecretJWT }},
+	{"POLKA_KEY", "API key Polka webhooks authenticate with", func(c *Config) any { return &c.PolkaKey }},
+	{"TOTP_ENCRYPTION_KEY", "base64 encoded 32 byte key TOTP secrets are encrypted with", func(c *Config) any { return &c.TOTPEncryptionKey }},
+
+	{"JWT_KEYS_DIR", "directory of RSA/Ed25519 *.pem signing keys, SECRET_JWT (HS256) is used when empty", func(c *Config) any { return &c.JWTKeysDir }},
+	{"JWT_SIGNING_KEY_ID", "kid of the key new tokens are signed with, defaults to the last one", func(c *Config) any { return &c.JWTSigningKeyID }},
+	{"JWT_ACCEPT_HS256", "keep accepting tokens signed with SECRET_JWT after switching to JWT_KEYS_DIR", func(c *Config) any { return &c.JWTAcceptHS256 }},
+	{"TOKEN_VERSION_CACHE_TTL", "how long a server may keep accepting access tokens revoked on another server", func(c *Config) any { return &c.TokenVersionCacheTTL }},
+
+	{"ADDR", "address the server listens on", func(c *Config) any { return &c.Addr }},
+	{"READ_TIMEOUT", "maximum time to read a request", func(c *Config) any { return &c.ReadTimeout }},
+	{"READ_HEADER_TIMEOUT", "maximum time to read request headers", func(c *Config) any { return &c.ReadHeaderTimeout }},
+	{"WRITE_TIMEOUT", "maximum time to write a response", func(c *Config) any { return &c.WriteTimeout }},
+	{"IDLE_TIMEOUT", "how long idle keep-alive connections stay open", func(c *Config) any { return &c.IdleTimeout }},
+	{"SHUTDOWN_TIMEOUT", "how long open requests get to finish on shutdown", func(c *Config) any { return &c.ShutdownTimeout }},
+	{"MAX_HEADER_BYTES", "maximum size of request headers", func(c *Config) any { return &c.MaxHeaderBytes }},
+
+	{"CHIRP_RETENTION", "how long deleted chirps are kept before they are purged", func(c *Config) any { return &c.ChirpRetention }},
+	{"PURGE_INTERVAL", "how often deleted chirps are purged", func(c *Config) any { return &c.PurgeInterval }},
+
+	{"BANNED_WORDS_FILE", "word list file, the banned_words table is used when empty", func(c *Config) any { return &c.BannedWordsFile }},
+	{"BANNED_WORDS_RELOAD_INTERVAL", "how often the word list is reloaded", func(c *Config) any { return &c.BannedWordsReloadInterval }},
+	{"REPORTS_TO_HIDE", "users who have to report a chirp before it is hidden until reviewed", func(c *Config) any { return &c.ReportsToHide }},
+
+	{"PUBLIC_URL", "URL clients reach the server at, used for links in emails", func(c *Config) any { return &c.PublicURL }},
+	{"MAIL_FROM", "sender address of emails", func(c *Config) any { return &c.MailFrom }},
+	{"SMTP_ADDR", "host:port of the SMTP server, emails are written to MAIL_DIR when empty, or the log on the dev platform", func(c *Config) any { return &c.SMTPAddr }},
+	{"SMTP_USERNAME", "SMTP user, no authentication when empty", func(c *Config) any { return &c.SMTPUsername }},
+	{"SMTP_PASSWORD", "SMTP password", func(c *Config) any { return &c.SMTPPassword }},
+	{"MAIL_DIR", "directory emails are written to instead of being sent", func(c *Config) any { return &c.MailDir }},
+	{"EMAIL_VERIFICATION_TTL", "how long email verification links work", func(c *Config) any { return &c.EmailVerificationTTL }},
+	{"PASSWORD_RESET_TTL", "how long password reset links work", func(c *Config) any { return &c.PasswordResetTTL }},
+	{"PASSWORD_RESET_URL", "page password reset links open, PUBLIC_URL/app/reset-password/ when empty", func(c *Config) any { return &c.PasswordResetURL }},
+
+	{"PASSWORD_MIN_LENGTH", "minimum number of characters in a password", func(c *Config) any { return &c.PasswordMinLength }},
+	{"PASSWORD_MAX_BYTES", "maximum password size in bytes", func(c *Config) any { return &c.PasswordMaxBytes }},
+	{"PASSWORD_MIN_CLASSES", "how many of lower case, upper case, digits and symbols a password has to mix", func(c *Config) any { return &c.PasswordMinClasses }},
+	{"BREACHED_PASSWORDS_FILE", "file of SHA-1 hashes of passwords users may not choose", func(c *Config) any { return &c.BreachedPasswordsFile }},
+
+	{"ARGON2_MEMORY", "Argon2id memory cost in KiB", func(c *Config) any { return &c.Argon2Memory }},
+	{"ARGON2_ITERATIONS", "Argon2id passes over the memory", func(c *Config) any { return &c.Argon2Iterations }},
+	{"ARGON2_PARALLELISM", "Argon2id threads", func(c *Config) any { return &c.Argon2Parallelism }},
+
+	{"LOGIN_ACCOUNT_BACKOFF_AFTER", "failed logins of one email before further attempts are slowed down", func(c *Config) any { return &c.LoginAccountBackoffAfter }},
+	{"LOGIN_ACCOUNT_LOCKOUT_AFTER", "failed logins of one email before it is locked out", func(c *Config) any { return &c.LoginAccountLockoutAfter }},
+	{"LOGIN_IP_BACKOFF_AFTER", "failed logins from one IP before further attempts are slowed down", func(c *Config) any { return &c.LoginIPBackoffAfter }},
+	{"LOGIN_IP_LOCKOUT_AFTER", "failed logins from one IP before it is locked out", func(c *Config) any { return &c.LoginIPLockoutAfter }},
+	{"LOGIN_BACKOFF_BASE", "first delay once logins are slowed down, doubled on every failure", func(c *Config) any { return &c.LoginBackoffBase }},
+	{"LOGIN_LOCKOUT_DURATION", "how long a lockout lasts and how long failures are remembered", func(c *Config) any { return &c.LoginLockoutDuration }},
+
+	{"TRUSTED_PROXIES", "comma separated IPs or CIDRs of proxies whose X-Forwarded-For is trusted", func(c *Config) any { return &c.TrustedProxies }},
+	{"RATE_LIMIT_DEFAULT", "requests per client per route, such as 120/1m", func(c *Config) any { return &c.RateLimitDefault }},
+	{"RATE_LIMITS", "comma separated route limits such as POST /api/login=10/1m, replaces the built in ones", func(c *Config) any { return &c.RateLimits }},
+
+	{"PLAN_FREE_MAX_CHIRP_LENGTH", "longest chirp without Chirpy Red", func(c *Config) any { return &c.Plans.Free.MaxChirpLength }},
+	{"PLAN_FREE_POST_RATE", "chirps a user without Chirpy Red may post, such as 10/1m", func(c *Config) any { return &c.Plans.Free.PostRate }},
+	{"PLAN_FREE_CAN_EDIT", "whether users without Chirpy Red may edit chirps", func(c *Config) any { return &c.Plans.Free.CanEditChirps }},
+	{"PLAN_RED_MAX_CHIRP_LENGTH", "longest chirp with Chirpy Red", func(c *Config) any { return &c.Plans.Red.MaxChirpLength }},
+	{"PLAN_RED_POST_RATE", "chirps a Chirpy Red user may post, such as 60/1m", func(c *Config) any { return &c.Plans.Red.PostRate }},
+	{"PLAN_RED_CAN_EDIT", "whether Chirpy Red users may edit chirps", func(c *Config) any { return &c.Plans.Red.CanEditChirps }},
+	{"SUBSCRIPTION_EXPIRY_INTERVAL", "how often Chirpy Red is taken from users whose subscription period ended", func(c *Config) any { return &c.SubscriptionExpiryInterval }},
+}
+
+func (f field) key() string {
+	return strings.ToLower(f.env)
+}
+
+func (f field) flagName() string {
+	return strings.ReplaceAll(f.key(), "_", "-")
+}
+
+func set(target any, value string) error {
+	switch target := target.(type) {
+	case *string:
+		*target = value
+	case *int:
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		*target = number
+	case *time.Duration:
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 1h", value)
+		}
+		*target = duration
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*target = b
+	case *ratelimit.Limit:
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			return err
+		}
+		*target = limit
+	case *map[string]ratelimit.Limit:
+		limits := map[string]ratelimit.Limit{}
+		for _, entry := range splitList(value) {
+			route, limit, ok := strings.Cut(entry, "=")
+			if !ok {
+				return fmt.Errorf("%q is not a route limit such as POST /api/login=10/1m", entry)
+			}
+			parsed, err := ratelimit.ParseLimit(limit)
+			if err != nil {
+				return err
+			}
+			limits[strings.TrimSpace(route)] = parsed
+		}
+		*target = limits
+	case *[]netip.Prefix:
+		prefixes := []netip.Prefix{}
+		for _, entry := range splitList(value) {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				addr, addrErr := netip.ParseAddr(entry)
+				if addrErr != nil {
+					return fmt.Errorf("%q is not an IP or CIDR", entry)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			prefixes = append(prefixes, prefix)
+		}
+		*target = prefixes
+	default:
+		return fmt.Errorf("unsupported config type %T", target)
+	}
+
+	return nil
+}
+
+// splitList splits a comma separated value, skipping empty entries
+func splitList(value string) []string {
+	entries := []string{}
+
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// Load builds the configuration from all sources and validates it.
+// args are the command line arguments without the program name, the
+// arguments left after the flags are returned.
+func Load(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+	envFile := fs.String("env-file", ".env", "dotenv file, skipped when it doesn't exist")
+
+	flagValues := map[string]*string{}
+
+	for _, f := range fields {
+		flagValues[f.env] = fs.String(f.flagName(), "", f.usage+" (env "+f.env+")")
+	}
+
+	err := fs.Parse(args)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := defaults()
+	errs := []error{}
+
+	if *configFile != "" {
+		values, err := readFile(*configFile)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, f := range fields {
+			if value, ok := values[f.key()]; ok {
+				if err := set(f.target(&cfg), value); err != nil {
+					errs = append(errs, fmt.Errorf("%s in %s: %w", f.key(), *configFile, err))
+				}
+			}
+		}
+	}
+
+	dotenv, err := godotenv.Read(*envFile)
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("reading %s: %w", *envFile, err)
+	}
+
+	for _, f := range fields {
+		value, ok := os.LookupEnv(f.env)
+
+		if !ok {
+			value, ok = dotenv[f.env]
+		}
+
+		if ok {
+			if err := set(f.target(&cfg), value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+			}
+		}
+	}
+
+	fs.Visit(func(fl *flag.Flag) {
+		for _, f := range fields {
+			if f.flagName() == fl.Name {
+				if err := set(f.target(&cfg), *flagValues[f.env]); err != nil {
+					errs = append(errs, fmt.Errorf("-%s: %w", fl.Name, err))
+				}
+			}
+		}
+	})
+
+	if len(errs) > 0 {
+		return nil, nil, invalid(errs)
+	}
+
+	// Stops floods of posts before the handler authenticates them, the plan
+	// post rate limits each user after that
+	if _, ok := cfg.RateLimits[postChirpsRoute]; !ok {
+		if cfg.RateLimits == nil {
+			cfg.RateLimits = map[string]ratelimit.Limit{}
+		}
+		cfg.RateLimits[postChirpsRoute] = widestLimit(cfg.Plans.Free.PostRate, cfg.Plans.Red.PostRate)
+	}
+
+	err = cfg.Validate()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &cfg, fs.Args(), nil
+}
+
+// widestLimit allows the largest burst of a and b at the faster rate of the
+// two, so it never refuses what either would allow
+func widestLimit(a, b ratelimit.Limit) ratelimit.Limit {
+	burst := max(a.Requests, b.Requests)
+
+	// How long refilling burst tokens takes at the rate of each limit
+	per := min(a.Per*time.Duration(burst)/time.Duration(a.Requests), b.Per*time.Duration(burst)/time.Duration(b.Requests))
+
+	return ratelimit.Limit{Requests: burst, Per: per}
+}
+
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := map[string]any{}
+
+	err = yaml.Unmarshal(data, &raw)
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+
+	for key, value := range raw {
+		text, err := fileValue(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("config file %s, %s: %w", path, key, err)
+		}
+
+		values[strings.ToLower(key)] = text
+	}
+
+	return values, nil
+}
+
+// fileValue turns a YAML value into the text the same setting would have
+// in the environment, lists become comma separated
+func fileValue(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case map[string]any:
+		return "", errors.New("nested maps aren't supported, write the value as in the environment")
+	case []any:
+		items := []string{}
+
+		for _, item := range value {
+			switch item.(type) {
+			case map[string]any, []any:
+				return "", errors.New("list items have to be plain values")
+			}
+
+			items = append(items, fmt.Sprint(item))
+		}
+
+		return strings.Join(items, ","), nil
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// Validate checks that required settings are present and sane
+func (c *Config) Validate() error {
+	errs := []error{}
+
+	if c.DBURL == "" {
+		errs = append(errs, errors.New("DB_URL is required"))
+	} else if u, err := url.Parse(c.DBURL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		errs = append(errs, errors.New("DB_URL must be a postgres:// URL"))
+	}
+
+	// The shared secret is only needed while access tokens are still HS256
+	if (c.JWTKeysDir == "" || c.JWTAcceptHS256) && len(c.SecretJWT) < minSecretLength {
+		errs = append(errs, fmt.Errorf("SECRET_JWT must be at least %d characters long", minSecretLength))
+	}
+
+	if c.JWTKeysDir == "" && c.JWTSigningKeyID != "" {
+		errs = append(errs, errors.New("JWT_SIGNING_KEY_ID needs JWT_KEYS_DIR"))
+	}
+
+	if c.PolkaKey == "" {
+		errs = append(errs, errors.New("POLKA_KEY is required"))
+	}
+
+	if _, err := auth.ParseSecretKey(c.TOTPEncryptionKey); err != nil {
+		errs = append(errs, fmt.Errorf("TOTP_ENCRYPTION_KEY must be %d random bytes, base64 encoded: %w", auth.SecretKeySize, err))
+	}
+
+	if c.Addr == "" {
+		errs = append(errs, errors.New("ADDR is required"))
+	}
+
+	if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, errors.New("PUBLIC_URL must be an http:// or https:// URL"))
+	}
+
+	if c.PasswordResetURL != "" {
+		if u, err := url.Parse(c.PasswordResetURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, errors.New("PASSWORD_RESET_URL must be an http:// or https:// URL"))
+		}
+	}
+
+	if _, err := mail.ParseAddress(c.MailFrom); err != nil {
+		errs = append(errs, errors.New("MAIL_FROM must be an email address"))
+	}
+
+	if c.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			errs = append(errs, errors.New("SMTP_ADDR must be host:port"))
+		}
+	} else if c.MailDir == "" && c.Platform != "dev" {
+		// Logged emails would put every verification and reset token in the log
+		errs = append(errs, errors.New("SMTP_ADDR or MAIL_DIR is required unless PLATFORM is dev"))
+	}
+
+	if c.PasswordMinLength < 1 {
+		errs = append(errs, errors.New("PASSWORD_MIN_LENGTH must be positive"))
+	}
+
+	if c.PasswordMaxBytes < c.PasswordMinLength || c.PasswordMaxBytes > maxPasswordBytes {
+		errs = append(errs, fmt.Errorf("PASSWORD_MAX_BYTES must be between PASSWORD_MIN_LENGTH and %d", maxPasswordBytes))
+	}
+
+	if c.Argon2Parallelism < 1 || c.Argon2Parallelism > 255 {
+		errs = append(errs, errors.New("ARGON2_PARALLELISM must be between 1 and 255"))
+	}
+
+	if c.Argon2Iterations < 1 {
+		errs = append(errs, errors.New("ARGON2_ITERATIONS must be positive"))
+	}
+
+	// Argon2 needs at least 8 KiB per thread
+	if c.Argon2Memory < 8*c.Argon2Parallelism || int64(c.Argon2Memory) > math.MaxUint32 {
+		errs = append(errs, errors.New("ARGON2_MEMORY must be at least 8 KiB per ARGON2_PARALLELISM thread"))
+	}
+
+	if c.PasswordMinClasses < 0 || c.PasswordMinClasses > 4 {
+		errs = append(errs, errors.New("PASSWORD_MIN_CLASSES must be between 0 and 4"))
+	}
+
+	if c.LoginAccountBackoffAfter < 1 || c.LoginAccountLockoutAfter < c.LoginAccountBackoffAfter {
+		errs = append(errs, errors.New("LOGIN_ACCOUNT_BACKOFF_AFTER must be positive and at most LOGIN_ACCOUNT_LOCKOUT_AFTER"))
+	}
+
+	if c.LoginIPBackoffAfter < 1 || c.LoginIPLockoutAfter < c.LoginIPBackoffAfter {
+		errs = append(errs, errors.New("LOGIN_IP_BACKOFF_AFTER must be positive and at most LOGIN_IP_LOCKOUT_AFTER"))
+	}
+
+	if c.Plans.Free.MaxChirpLength < 1 || c.Plans.Red.MaxChirpLength < 1 {
+		errs = append(errs, errors.New("PLAN_FREE_MAX_CHIRP_LENGTH and PLAN_RED_MAX_CHIRP_LENGTH must be positive"))
+	}
+
+	if c.ReportsToHide < 1 {
+		errs = append(errs, errors.New("REPORTS_TO_HIDE must be positive"))
+	}
+
+	if c.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("MAX_HEADER_BYTES must be positive"))
+	}
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"READ_TIMEOUT", c.ReadTimeout},
+		{"READ_HEADER_TIMEOUT", c.ReadHeaderTimeout},
+		{"WRITE_TIMEOUT", c.WriteTimeout},
+		{"IDLE_TIMEOUT", c.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+		{"TOKEN_VERSION_CACHE_TTL", c.TokenVersionCacheTTL},
+		{"CHIRP_RETENTION", c.ChirpRetention},
+		{"PURGE_INTERVAL", c.PurgeInterval},
+		{"SUBSCRIPTION_EXPIRY_INTERVAL", c.SubscriptionExpiryInterval},
+		{"BANNED_WORDS_RELOAD_INTERVAL", c.BannedWordsReloadInterval},
+		{"EMAIL_VERIFICATION_TTL", c.EmailVerificationTTL},
+		{"PASSWORD_RESET_TTL", c.PasswordResetTTL},
+		{"LOGIN_BACKOFF_BASE", c.LoginBackoffBase},
+		{"LOGIN_LOCKOUT_DURATION", c.LoginLockoutDuration},
+	}
+
+	for _, duration := range durations {
+		if duration.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", duration.name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return invalid(errs)
+	}
+
+	return nil
+}
+
+// invalid joins every problem into one error with one problem per line
+func invalid(errs []error) error {
+	lines := []string{"invalid configuration:"}
+
+	for _, err := range errs {
+		lines = append(lines, "  - "+err.Error())
+	}
+
+	return errors.New(strings.Join(lines, "\n"))
+}
@@ -6,33 +6,133 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type BannedWord struct {
+	Word        string
+	Action      string
+	Replacement sql.NullString
+	CreatedAt   time.Time
+}
+
+type EmailVerificationToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type ModerationQueue struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PostID      uuid.UUID
+	Source      string
+	Reason      string
+	ReporterID  uuid.NullUUID
+	ReportCount int32
+	Status      string
+	ResolvedAt  sql.NullTime
+	Hidden      bool
+}
+
+type ModerationReport struct {
+	ItemID     uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+	CreatedAt  time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
 type Post struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	DeletedAt    sql.NullTime
+	SearchVector interface{}
+}
+
+type PostRevision struct {
 	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	PostID    uuid.UUID
 	Body      string
+	CreatedAt time.Time
+	RevisedAt time.Time
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
 	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
 }
 
 type RefreshToken struct {
-	Token     string
+	TokenHash string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
 	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+	UserAgent string
+	IpAddress string
+}
+
+type Subscription struct {
+	UserID           uuid.UUID
+	Status           string
+	CurrentPeriodEnd sql.NullTime
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	LastEventAt      sql.NullTime
+}
+
+type TotpCredential struct {
+	UserID       uuid.UUID
+	Secret       string
+	CreatedAt    time.Time
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsChirpyRed     bool
+	Role            string
+	TokenVersion    int32
+	EmailVerifiedAt sql.NullTime
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID
+	EventID     sql.NullString
+	EventType   string
+	Payload     json.RawMessage
+	ReceivedAt  time.Time
+	Status      string
+	Error       sql.NullString
+	Attempts    int32
+	ProcessedAt sql.NullTime
+	ClaimedAt   time.Time
 }
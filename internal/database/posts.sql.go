@@ -8,6 +8,7 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -29,9 +30,17 @@ type CreatePostParams struct {
 	UserID uuid.UUID
 }
 
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
+type CreatePostRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (CreatePostRow, error) {
 	row := q.db.QueryRowContext(ctx, createPost, arg.Body, arg.UserID)
-	var i Post
+	var i CreatePostRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
@@ -43,8 +52,9 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 }
 
 const deletePost = `-- name: DeletePost :execresult
-DELETE FROM posts
-WHERE $1 = id AND user_id = $2
+UPDATE posts
+SET deleted_at = NOW()
+WHERE $1 = id AND user_id = $2 AND deleted_at IS NULL
 `
 
 type DeletePostParams struct {
@@ -67,12 +77,47 @@ func (q *Queries) DeletePosts(ctx context.Context) error {
 
 const getPost = `-- name: GetPost :one
 SELECT id, created_at, updated_at, body, user_id FROM posts
-WHERE $1 = id
+WHERE $1 = id AND deleted_at IS NULL
 `
 
-func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (Post, error) {
+type GetPostRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (GetPostRow, error) {
 	row := q.db.QueryRowContext(ctx, getPost, id)
-	var i Post
+	var i GetPostRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const getPostForUpdate = `-- name: GetPostForUpdate :one
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE id = $1 AND deleted_at IS NULL
+FOR UPDATE
+`
+
+type GetPostForUpdateRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) GetPostForUpdate(ctx context.Context, id uuid.UUID) (GetPostForUpdateRow, error) {
+	row := q.db.QueryRowContext(ctx, getPostForUpdate, id)
+	var i GetPostForUpdateRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
@@ -85,18 +130,27 @@ func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (Post, error) {
 
 const getPosts = `-- name: GetPosts :many
 SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetPosts(ctx context.Context) ([]Post, error) {
+type GetPostsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) GetPosts(ctx context.Context) ([]GetPostsRow, error) {
 	rows, err := q.db.QueryContext(ctx, getPosts)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []GetPostsRow
 	for rows.Next() {
-		var i Post
+		var i GetPostsRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
@@ -120,24 +174,544 @@ func (q *Queries) GetPosts(ctx context.Context) ([]Post, error) {
 const getUserPosts = `-- name: GetUserPosts :many
 SELECT id, created_at, updated_at, body, user_id FROM posts
 WHERE user_id = $1
+AND deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetUserPosts(ctx context.Context, userID uuid.UUID) ([]Post, error) {
+type GetUserPostsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) GetUserPosts(ctx context.Context, userID uuid.UUID) ([]GetUserPostsRow, error) {
 	rows, err := q.db.QueryContext(ctx, getUserPosts, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []GetUserPostsRow
+	for rows.Next() {
+		var i GetUserPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getVisiblePost = `-- name: GetVisiblePost :one
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE id = $1 AND deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+`
+
+type GetVisiblePostRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+// GetPost without the chirps that are hidden until reviewed
+func (q *Queries) GetVisiblePost(ctx context.Context, id uuid.UUID) (GetVisiblePostRow, error) {
+	row := q.db.QueryRowContext(ctx, getVisiblePost, id)
+	var i GetVisiblePostRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const listPostsByCreatedAtAsc = `-- name: ListPostsByCreatedAtAsc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND ($1::uuid IS NULL OR user_id = $1::uuid)
+AND ($2::uuid IS NULL OR (created_at, id) > ($3::timestamp, $2::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type ListPostsByCreatedAtAscParams struct {
+	AuthorID   uuid.NullUUID
+	CursorID   uuid.NullUUID
+	CursorTime sql.NullTime
+	PageLimit  int32
+}
+
+type ListPostsByCreatedAtAscRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) ListPostsByCreatedAtAsc(ctx context.Context, arg ListPostsByCreatedAtAscParams) ([]ListPostsByCreatedAtAscRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPostsByCreatedAtAsc,
+		arg.AuthorID,
+		arg.CursorID,
+		arg.CursorTime,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPostsByCreatedAtAscRow
+	for rows.Next() {
+		var i ListPostsByCreatedAtAscRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPostsByCreatedAtDesc = `-- name: ListPostsByCreatedAtDesc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND ($1::uuid IS NULL OR user_id = $1::uuid)
+AND ($2::uuid IS NULL OR (created_at, id) < ($3::timestamp, $2::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type ListPostsByCreatedAtDescParams struct {
+	AuthorID   uuid.NullUUID
+	CursorID   uuid.NullUUID
+	CursorTime sql.NullTime
+	PageLimit  int32
+}
+
+type ListPostsByCreatedAtDescRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) ListPostsByCreatedAtDesc(ctx context.Context, arg ListPostsByCreatedAtDescParams) ([]ListPostsByCreatedAtDescRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPostsByCreatedAtDesc,
+		arg.AuthorID,
+		arg.CursorID,
+		arg.CursorTime,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPostsByCreatedAtDescRow
+	for rows.Next() {
+		var i ListPostsByCreatedAtDescRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPostsByLengthAsc = `-- name: ListPostsByLengthAsc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND ($1::uuid IS NULL OR user_id = $1::uuid)
+AND ($2::uuid IS NULL OR (char_length(body), id) > ($3::int, $2::uuid))
+ORDER BY char_length(body) ASC, id ASC
+LIMIT $4
+`
+
+type ListPostsByLengthAscParams struct {
+	AuthorID     uuid.NullUUID
+	CursorID     uuid.NullUUID
+	CursorLength sql.NullInt32
+	PageLimit    int32
+}
+
+type ListPostsByLengthAscRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) ListPostsByLengthAsc(ctx context.Context, arg ListPostsByLengthAscParams) ([]ListPostsByLengthAscRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPostsByLengthAsc,
+		arg.AuthorID,
+		arg.CursorID,
+		arg.CursorLength,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPostsByLengthAscRow
+	for rows.Next() {
+		var i ListPostsByLengthAscRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPostsByLengthDesc = `-- name: ListPostsByLengthDesc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND ($1::uuid IS NULL OR user_id = $1::uuid)
+AND ($2::uuid IS NULL OR (char_length(body), id) < ($3::int, $2::uuid))
+ORDER BY char_length(body) DESC, id DESC
+LIMIT $4
+`
+
+type ListPostsByLengthDescParams struct {
+	AuthorID     uuid.NullUUID
+	CursorID     uuid.NullUUID
+	CursorLength sql.NullInt32
+	PageLimit    int32
+}
+
+type ListPostsByLengthDescRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) ListPostsByLengthDesc(ctx context.Context, arg ListPostsByLengthDescParams) ([]ListPostsByLengthDescRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPostsByLengthDesc,
+		arg.AuthorID,
+		arg.CursorID,
+		arg.CursorLength,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPostsByLengthDescRow
+	for rows.Next() {
+		var i ListPostsByLengthDescRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPostsByUpdatedAtAsc = `-- name: ListPostsByUpdatedAtAsc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND ($1::uuid IS NULL OR user_id = $1::uuid)
+AND ($2::uuid IS NULL OR (updated_at, id) > ($3::timestamp, $2::uuid))
+ORDER BY updated_at ASC, id ASC
+LIMIT $4
+`
+
+type ListPostsByUpdatedAtAscParams struct {
+	AuthorID   uuid.NullUUID
+	CursorID   uuid.NullUUID
+	CursorTime sql.NullTime
+	PageLimit  int32
+}
+
+type ListPostsByUpdatedAtAscRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) ListPostsByUpdatedAtAsc(ctx context.Context, arg ListPostsByUpdatedAtAscParams) ([]ListPostsByUpdatedAtAscRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPostsByUpdatedAtAsc,
+		arg.AuthorID,
+		arg.CursorID,
+		arg.CursorTime,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPostsByUpdatedAtAscRow
+	for rows.Next() {
+		var i ListPostsByUpdatedAtAscRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPostsByUpdatedAtDesc = `-- name: ListPostsByUpdatedAtDesc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND ($1::uuid IS NULL OR user_id = $1::uuid)
+AND ($2::uuid IS NULL OR (updated_at, id) < ($3::timestamp, $2::uuid))
+ORDER BY updated_at DESC, id DESC
+LIMIT $4
+`
+
+type ListPostsByUpdatedAtDescParams struct {
+	AuthorID   uuid.NullUUID
+	CursorID   uuid.NullUUID
+	CursorTime sql.NullTime
+	PageLimit  int32
+}
+
+type ListPostsByUpdatedAtDescRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) ListPostsByUpdatedAtDesc(ctx context.Context, arg ListPostsByUpdatedAtDescParams) ([]ListPostsByUpdatedAtDescRow, error) {
+	rows, err := q.db.QueryContext(ctx, listPostsByUpdatedAtDesc,
+		arg.AuthorID,
+		arg.CursorID,
+		arg.CursorTime,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPostsByUpdatedAtDescRow
+	for rows.Next() {
+		var i ListPostsByUpdatedAtDescRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedPosts = `-- name: PurgeDeletedPosts :execrows
+DELETE FROM posts
+WHERE deleted_at IS NOT NULL
+AND deleted_at < NOW() - make_interval(secs => $1::float8)
+`
+
+// The cutoff is computed with the same clock that wrote deleted_at
+func (q *Queries) PurgeDeletedPosts(ctx context.Context, retentionSeconds float64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedPosts, retentionSeconds)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const removePost = `-- name: RemovePost :execresult
+UPDATE posts
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) RemovePost(ctx context.Context, id uuid.UUID) (sql.Result, error) {
+	return q.db.ExecContext(ctx, removePost, id)
+}
+
+const restorePost = `-- name: RestorePost :execresult
+UPDATE posts
+SET deleted_at = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL
+`
+
+func (q *Queries) RestorePost(ctx context.Context, id uuid.UUID) (sql.Result, error) {
+	return q.db.ExecContext(ctx, restorePost, id)
+}
+
+const searchPosts = `-- name: SearchPosts :many
+SELECT
+    posts.id, posts.created_at, posts.updated_at, posts.body, posts.user_id,
+    ts_rank(posts.search_vector, query)::real AS rank,
+    CASE WHEN $1::boolean
+        THEN ts_headline('english', posts.body, query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')
+        ELSE ''
+    END::text AS snippet
+FROM posts, websearch_to_tsquery('english', $2::text) AS query
+WHERE posts.search_vector @@ query
+AND posts.deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND ($3::uuid IS NULL OR posts.user_id = $3::uuid)
+ORDER BY rank DESC, posts.created_at DESC, posts.id DESC
+LIMIT $4
+`
+
+type SearchPostsParams struct {
+	Highlight bool
+	Query     string
+	AuthorID  uuid.NullUUID
+	PageLimit int32
+}
+
+type SearchPostsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	Rank      float32
+	Snippet   string
+}
+
+func (q *Queries) SearchPosts(ctx context.Context, arg SearchPostsParams) ([]SearchPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPosts,
+		arg.Highlight,
+		arg.Query,
+		arg.AuthorID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsRow
 	for rows.Next() {
-		var i Post
+		var i SearchPostsRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.Rank,
+			&i.Snippet,
 		); err != nil {
 			return nil, err
 		}
@@ -151,3 +725,37 @@ func (q *Queries) GetUserPosts(ctx context.Context, userID uuid.UUID) ([]Post, e
 	}
 	return items, nil
 }
+
+const updatePost = `-- name: UpdatePost :one
+UPDATE posts
+SET body = $1, updated_at = NOW()
+WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id
+`
+
+type UpdatePostParams struct {
+	Body   string
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+type UpdatePostRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+}
+
+func (q *Queries) UpdatePost(ctx context.Context, arg UpdatePostParams) (UpdatePostRow, error) {
+	row := q.db.QueryRowContext(ctx, updatePost, arg.Body, arg.ID, arg.UserID)
+	var i UpdatePostRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+	)
+	return i, err
+}
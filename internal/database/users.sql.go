@@ -12,6 +12,20 @@ import (
 	"github.com/google/uuid"
 )
 
+const bumpUserTokenVersion = `-- name: BumpUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version
+`
+
+func (q *Queries) BumpUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, bumpUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -21,7 +35,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, token_version, email_verified_at
 `
 
 type CreateUserParams struct {
@@ -39,6 +53,9 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -53,7 +70,7 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, token_version, email_verified_at FROM users
 WHERE email = $1
 `
 
@@ -67,15 +84,132 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, token_version, email_verified_at FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserByIDForUpdate = `-- name: GetUserByIDForUpdate :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, token_version, email_verified_at FROM users
+WHERE id = $1
+FOR UPDATE
+`
+
+func (q *Queries) GetUserByIDForUpdate(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByIDForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserTokenVersion = `-- name: GetUserTokenVersion :one
+SELECT token_version FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserTokenVersion(ctx context.Context, id uuid.UUID) (int32, error) {
+	row := q.db.QueryRowContext(ctx, getUserTokenVersion, id)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const rehashUserPassword = `-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = $1
+WHERE id = $2
+AND hashed_password = $3
+`
+
+type RehashUserPasswordParams struct {
+	NewHash string
+	ID      uuid.UUID
+	OldHash string
+}
+
+func (q *Queries) RehashUserPassword(ctx context.Context, arg RehashUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, rehashUserPassword, arg.NewHash, arg.ID, arg.OldHash)
+	return err
+}
+
+const resetUserPassword = `-- name: ResetUserPassword :one
+UPDATE users
+SET hashed_password = $1, updated_at = NOW(), token_version = token_version + 1
+WHERE id = $2
+RETURNING token_version
+`
+
+type ResetUserPasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) ResetUserPassword(ctx context.Context, arg ResetUserPasswordParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, resetUserPassword, arg.HashedPassword, arg.ID)
+	var token_version int32
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const setUserRoleByEmail = `-- name: SetUserRoleByEmail :execresult
+UPDATE users
+SET role = $1, updated_at = NOW()
+WHERE email = $2
+`
+
+type SetUserRoleByEmailParams struct {
+	Role  string
+	Email string
+}
+
+func (q *Queries) SetUserRoleByEmail(ctx context.Context, arg SetUserRoleByEmailParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, setUserRoleByEmail, arg.Role, arg.Email)
+}
+
 const updateUserPasswordAndEmail = `-- name: UpdateUserPasswordAndEmail :one
 UPDATE users
-SET hashed_password = $1, email = $2, updated_at = NOW()
+SET hashed_password = $1,
+    email = $2,
+    updated_at = NOW(),
+    token_version = token_version + 1,
+    -- A new address has to be verified again
+    email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END
 WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, token_version, email_verified_at
 `
 
 type UpdateUserPasswordAndEmailParams struct {
@@ -94,6 +228,9 @@ func (q *Queries) UpdateUserPasswordAndEmail(ctx context.Context, arg UpdateUser
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.TokenVersion,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -112,3 +249,23 @@ type UpgradeUserParams struct {
 func (q *Queries) UpgradeUser(ctx context.Context, arg UpgradeUserParams) (sql.Result, error) {
 	return q.db.ExecContext(ctx, upgradeUser, arg.IsChirpyRed, arg.ID)
 }
+
+const verifyUserEmail = `-- name: VerifyUserEmail :execrows
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1
+AND email = $2
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
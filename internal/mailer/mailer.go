@@ -0,0 +1,100 @@
+// Package mailer sends the emails the server needs, such as address
+// verification links.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// format renders the message as a plain text RFC 5322 email
+func format(from string, msg Message) []byte {
+	headers := []string{
+		"From: " + from,
+		"To: " + msg.To,
+		"Subject: " + msg.Subject,
+		"Date: " + time.Now().UTC().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+}
+
+// SMTPMailer delivers through an SMTP server. It authenticates with PLAIN
+// auth when Username is set, which net/smtp only allows over TLS or to
+// localhost.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	var auth smtp.Auth
+
+	if m.Username != "" {
+		host, _, _ := strings.Cut(m.Addr, ":")
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	// net/smtp can't be cancelled, at least don't start after the request
+	// went away
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, format(m.From, msg))
+
+	if err != nil {
+		return fmt.Errorf("sending mail to %s: %w", msg.To, err)
+	}
+
+	return nil
+}
+
+// FileMailer writes every message to its own .eml file in Dir instead of
+// sending it, for development and tests
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	name := time.Now().UTC().Format("20060102T150405") + "-" + uuid.NewString() + ".eml"
+
+	err := os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg), 0o600)
+
+	if err != nil {
+		return fmt.Errorf("writing mail to %s: %w", msg.To, err)
+	}
+
+	return nil
+}
+
+// LogMailer prints messages to the log instead of sending them
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,166 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Action is what happens to a chirp when it contains a listed word
+type Action string
+
+const (
+	ActionReplace Action = "replace"
+	ActionReject  Action = "reject"
+	ActionFlag    Action = "flag"
+)
+
+const DefaultReplacement = "****"
+
+func ParseAction(s string) (Action, error) {
+	switch Action(strings.ToLower(s)) {
+	case ActionReplace:
+		return ActionReplace, nil
+	case ActionReject:
+		return ActionReject, nil
+	case ActionFlag:
+		return ActionFlag, nil
+	}
+
+	return "", fmt.Errorf("unknown moderation action %q", s)
+}
+
+// Rule is a single entry of the word list
+type Rule struct {
+	Word        string
+	Action      Action
+	Replacement string
+}
+
+type Match struct {
+	Word   string
+	Action Action
+}
+
+// Result is the outcome of checking a chirp. Text has every replace rule
+// applied, Rejected and Flagged are set when any reject or flag rule matched.
+type Result struct {
+	Text     string
+	Rejected bool
+	Flagged  bool
+	Matches  []Match
+}
+
+type Filter interface {
+	Check(text string) Result
+}
+
+// WordFilter matches whole words against a word list loaded from a Source.
+// Call Reload to pick up changes to the list without a restart.
+type WordFilter struct {
+	source Source
+
+	mu    sync.RWMutex
+	rules map[string]Rule
+}
+
+func NewWordFilter(ctx context.Context, source Source) (*WordFilter, error) {
+	filter := &WordFilter{source: source}
+
+	err := filter.Reload(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// Reload replaces the word list with the current content of the source.
+// The old list is kept if loading fails.
+func (f *WordFilter) Reload(ctx context.Context) error {
+	rules, err := f.source.Load(ctx)
+
+	if err != nil {
+		return fmt.Errorf("loading word list: %w", err)
+	}
+
+	byWord := make(map[string]Rule, len(rules))
+
+	for _, rule := range rules {
+		if rule.Word == "" {
+			return errors.New("word list contains an empty word")
+		}
+		if rule.Action == "" {
+			rule.Action = ActionReplace
+		}
+		if rule.Action == ActionReplace && rule.Replacement == "" {
+			rule.Replacement = DefaultReplacement
+		}
+		byWord[normalize(rule.Word, false)] = rule
+	}
+
+	f.mu.Lock()
+	f.rules = byWord
+	f.mu.Unlock()
+
+	return nil
+}
+
+func (f *WordFilter) Check(text string) Result {
+	f.mu.RLock()
+	rules := f.rules
+	f.mu.RUnlock()
+
+	result := Result{}
+
+	var builder strings.Builder
+	last := 0
+
+	for _, token := range tokenize(text) {
+		rule, ok := lookup(rules, token.text)
+
+		// "$harbert" reads '$' as a letter, "@kerfuffle" as punctuation
+		if !ok {
+			if trimmed, trimmedOK := trimLeetSymbols(token); trimmedOK {
+				rule, ok = lookup(rules, trimmed.text)
+				token = trimmed
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		result.Matches = append(result.Matches, Match{Word: rule.Word, Action: rule.Action})
+
+		switch rule.Action {
+		case ActionReject:
+			result.Rejected = true
+		case ActionFlag:
+			result.Flagged = true
+		case ActionReplace:
+			builder.WriteString(text[last:token.start])
+			builder.WriteString(rule.Replacement)
+			last = token.end
+		}
+	}
+
+	builder.WriteString(text[last:])
+	result.Text = builder.String()
+
+	return result
+}
+
+// lookup finds the rule of word, trying both readings of '1'
+func lookup(rules map[string]Rule, word string) (Rule, bool) {
+	rule, ok := rules[normalize(word, false)]
+
+	if !ok && strings.ContainsRune(word, '1') {
+		rule, ok = rules[normalize(word, true)]
+	}
+
+	return rule, ok
+}
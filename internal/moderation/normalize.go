@@ -0,0 +1,112 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+)
+
+type token struct {
+	text  string
+	start int
+	end   int
+}
+
+// leetspeak characters and the letter they usually stand for. '1' is tried
+// as both 'i' and 'l', see normalize.
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'3': 'e',
+	'4': 'a',
+	'5': 's',
+	'7': 't',
+	'8': 'b',
+	'@': 'a',
+	'$': 's',
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || isLeetSymbol(r)
+}
+
+// isLeetSymbol reports whether r is a symbol that can stand for a letter,
+// such as '@' in "h@rbert". At the edges of a word it is as often plain
+// punctuation, see trimLeetSymbols.
+func isLeetSymbol(r rune) bool {
+	return r == '@' || r == '$'
+}
+
+// trimLeetSymbols drops '@' and '$' from the edges of t, so "@kerfuffle"
+// and "fornax@" can be matched as "kerfuffle" and "fornax". It reports
+// whether anything is left that differs from t.
+func trimLeetSymbols(t token) (token, bool) {
+	text := strings.TrimLeftFunc(t.text, isLeetSymbol)
+	start := t.start + len(t.text) - len(text)
+	text = strings.TrimRightFunc(text, isLeetSymbol)
+
+	if text == "" || text == t.text {
+		return t, false
+	}
+
+	return token{text: text, start: start, end: start + len(text)}, true
+}
+
+// tokenize splits text into words, dropping surrounding punctuation so
+// "Kerfuffle!" and "(kerfuffle)" both yield "Kerfuffle"
+func tokenize(text string) []token {
+	tokens := []token{}
+	start := -1
+
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{text: text[start:i], start: start, end: i})
+			start = -1
+		}
+	}
+
+	if start >= 0 {
+		tokens = append(tokens, token{text: text[start:], start: start, end: len(text)})
+	}
+
+	return tokens
+}
+
+// foldRune maps every case variant of r to the same rune, including ones
+// strings.ToLower misses such as the Kelvin sign or the long s
+func foldRune(r rune) rune {
+	min := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return unicode.ToLower(min)
+}
+
+// normalize case folds word and undoes leetspeak. Leetspeak is only
+// undone for words that also contain letters so plain numbers are left
+// alone. oneAsL reads '1' as 'l' instead of 'i'.
+func normalize(word string, oneAsL bool) string {
+	hasLetter := strings.IndexFunc(word, unicode.IsLetter) >= 0
+
+	var builder strings.Builder
+
+	for _, r := range word {
+		if hasLetter {
+			if r == '1' && oneAsL {
+				r = 'l'
+			} else if replacement, ok := leet[r]; ok {
+				r = replacement
+			}
+		}
+		builder.WriteRune(foldRune(r))
+	}
+
+	return builder.String()
+}
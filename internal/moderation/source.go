@@ -0,0 +1,75 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Source provides the word list used by WordFilter
+type Source interface {
+	Load(ctx context.Context) ([]Rule, error)
+}
+
+// SourceFunc lets an ordinary function, such as a database query, act as a Source
+type SourceFunc func(ctx context.Context) ([]Rule, error)
+
+func (f SourceFunc) Load(ctx context.Context) ([]Rule, error) {
+	return f(ctx)
+}
+
+// FileSource reads a word list with one rule per line:
+//
+//	word [action] [replacement]
+//
+// action defaults to replace. Blank lines and lines starting with # are skipped.
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Load(ctx context.Context) ([]Rule, error) {
+	file, err := os.Open(s.Path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	rules := []Rule{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		rule := Rule{Word: fields[0], Action: ActionReplace}
+
+		if len(fields) > 1 {
+			rule.Action, err = ParseAction(fields[1])
+
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", s.Path, lineNumber, err)
+			}
+		}
+
+		if len(fields) > 2 {
+			rule.Replacement = fields[2]
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
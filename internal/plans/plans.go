@@ -0,0 +1,53 @@
+// Package plans declares what every subscription plan is entitled to. The
+// API asks the table instead of checking is_chirpy_red itself.
+package plans
+
+import (
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/ratelimit"
+)
+
+// Plan is the set of entitlements of one subscription plan
+type Plan struct {
+	Name string
+	// MaxChirpLength is the longest chirp body in characters
+	MaxChirpLength int
+	// PostRate limits how many chirps a user may post
+	PostRate ratelimit.Limit
+	// CanEditChirps allows editing chirps after posting them
+	CanEditChirps bool
+}
+
+// Table holds every plan. Users without Chirpy Red are on Free.
+type Table struct {
+	Free Plan
+	Red  Plan
+}
+
+// DefaultTable is the table used when nothing is configured
+func DefaultTable() Table {
+	return Table{
+		Free: Plan{
+			Name:           "free",
+			MaxChirpLength: 140,
+			PostRate:       ratelimit.Limit{Requests: 10, Per: time.Minute},
+			CanEditChirps:  false,
+		},
+		Red: Plan{
+			Name:           "red",
+			MaxChirpLength: 280,
+			PostRate:       ratelimit.Limit{Requests: 60, Per: time.Minute},
+			CanEditChirps:  true,
+		},
+	}
+}
+
+// For returns the plan of a user
+func (t Table) For(isChirpyRed bool) Plan {
+	if isChirpyRed {
+		return t.Red
+	}
+
+	return t.Free
+}
@@ -0,0 +1,143 @@
+// Package ratelimit implements token bucket rate limiting with a swappable
+// store for the buckets.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests requests per Per. Unused requests add up to a burst
+// of at most Requests.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseLimit parses limits such as 10/1m or 100/1h
+func ParseLimit(s string) (Limit, error) {
+	requests, per, ok := strings.Cut(strings.TrimSpace(s), "/")
+
+	if !ok {
+		return Limit{}, fmt.Errorf("%q is not a limit such as 10/1m", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("%q is not a limit such as 10/1m", s)
+	}
+
+	duration, err := time.ParseDuration(per)
+
+	if err != nil || duration <= 0 {
+		return Limit{}, fmt.Errorf("%q is not a limit such as 10/1m", s)
+	}
+
+	return Limit{Requests: n, Per: duration}, nil
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// rate is the number of tokens added per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request is allowed, 0 when
+	// Allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets. Swap the memory store for a shared one, such as
+// Redis, to limit across several servers.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	per    time.Duration
+}
+
+// MemoryStore keeps buckets in the memory of this process
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	// Now is the clock of the store, tests replace it
+	Now func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, Now: time.Now}
+}
+
+// Take removes a token from the bucket of key, if there is one
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	s.sweep(now)
+
+	capacity := float64(limit.Requests)
+	b, ok := s.buckets[key]
+
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*limit.rate())
+	b.last = now
+	b.per = limit.Per
+
+	result := Result{Limit: limit.Requests}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / limit.rate())
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / limit.rate())
+
+	return result, nil
+}
+
+// sweep drops full buckets, they behave the same as missing ones. It runs
+// at most once a minute.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+
+	for key, b := range s.buckets {
+		if now.Sub(b.last) >= b.per {
+			delete(s.buckets, key)
+		}
+	}
+
+	s.lastSweep = now
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// startJob runs job every interval in a goroutine of cfg.background, so
+// main can wait for a run in progress before it closes the database
+func (cfg *apiConfig) startJob(ctx context.Context, interval time.Duration, job func(ctx context.Context)) {
+	cfg.background.Add(1)
+
+	go func() {
+		defer cfg.background.Done()
+		runEvery(ctx, interval, job)
+	}()
+}
+
+// runEvery calls job once per interval until ctx is cancelled
+func runEvery(ctx context.Context, interval time.Duration, job func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job(ctx)
+		}
+	}
+}
+
+// purgeDeletedPosts permanently removes chirps that were soft deleted
+// more than retention ago
+func (cfg *apiConfig) purgeDeletedPosts(ctx context.Context, retention time.Duration) {
+	purged, err := cfg.dbQueries.PurgeDeletedPosts(ctx, retention.Seconds())
+
+	if err != nil {
+		log.Printf("Error purging deleted posts: %s", err)
+		return
+	}
+
+	if purged > 0 {
+		log.Printf("Purged %d deleted posts", purged)
+	}
+}
+
+// expireSubscriptions takes Chirpy Red away from users whose subscription
+// period is over
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context) {
+	expired, err := cfg.dbQueries.ExpireSubscriptions(ctx)
+
+	if err != nil {
+		log.Printf("Error expiring subscriptions: %s", err)
+		return
+	}
+
+	if expired > 0 {
+		log.Printf("Expired %d Chirpy Red subscriptions", expired)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loginKey is the account key of the login throttle. Emails without an
+// account are counted too, so a lockout doesn't reveal which ones exist.
+func loginKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginAttempt is a login reserved against the account and the client IP
+// throttles before the password or code is checked. It ends with failed or
+// succeeded, release ends it without an outcome and does nothing after
+// those.
+type loginAttempt struct {
+	cfg        *apiConfig
+	accountKey string
+	ip         string
+	done       bool
+}
+
+// startLogin reserves an attempt of the account and the client IP. When
+// either has to wait the attempt is nil, the wait is the longer one.
+func (cfg *apiConfig) startLogin(accountKey, ip string) (*loginAttempt, time.Duration) {
+	now := time.Now()
+
+	wait, ok := cfg.accountThrottle.Acquire(accountKey, now)
+
+	if !ok {
+		return nil, max(wait, cfg.ipThrottle.Wait("ip:"+ip, now))
+	}
+
+	wait, ok = cfg.ipThrottle.Acquire("ip:"+ip, now)
+
+	if !ok {
+		cfg.accountThrottle.Release(accountKey)
+		return nil, wait
+	}
+
+	return &loginAttempt{cfg: cfg, accountKey: accountKey, ip: ip}, 0
+}
+
+// failed counts the attempt against the account and the client IP, and
+// logs when either starts being slowed down or locked out
+func (a *loginAttempt) failed() {
+	if a.done {
+		return
+	}
+	a.done = true
+
+	cfg, accountKey, ip := a.cfg, a.accountKey, a.ip
+	now := time.Now()
+
+	accountFailures := cfg.accountThrottle.Fail(accountKey, now)
+
+	switch {
+	case cfg.accountThrottle.Locked(accountFailures):
+		log.Printf("SECURITY login lockout: %s locked after %d failed attempts, last from %s", accountKey, accountFailures, ip)
+	case cfg.accountThrottle.BackingOff(accountFailures):
+		log.Printf("SECURITY login backoff: %s has %d failed attempts, last from %s", accountKey, accountFailures, ip)
+	}
+
+	ipFailures := cfg.ipThrottle.Fail("ip:"+ip, now)
+
+	switch {
+	case cfg.ipThrottle.Locked(ipFailures):
+		log.Printf("SECURITY login lockout: IP %s locked after %d failed attempts, last for %s", ip, ipFailures, accountKey)
+	case cfg.ipThrottle.BackingOff(ipFailures):
+		log.Printf("SECURITY login backoff: IP %s has %d failed attempts, last for %s", ip, ipFailures, accountKey)
+	}
+}
+
+// succeeded forgets the failures of the account, those of the IP stay
+func (a *loginAttempt) succeeded() {
+	if a.done {
+		return
+	}
+	a.done = true
+
+	a.cfg.accountThrottle.Reset(a.accountKey)
+	a.cfg.ipThrottle.Release("ip:" + a.ip)
+}
+
+// release ends an attempt that has no outcome, such as one that hit a
+// database error. Handlers defer it right after startLogin.
+func (a *loginAttempt) release() {
+	if a.done {
+		return
+	}
+	a.done = true
+
+	a.cfg.accountThrottle.Release(a.accountKey)
+	a.cfg.ipThrottle.Release("ip:" + a.ip)
+}
+
+func respondTooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+	respondWithError(w, http.StatusTooManyRequests, "ERROR too many failed login attempts, try again later", nil)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	throttle := auth.NewLoginThrottle(auth.ThrottlePolicy{
+		BackoffAfter:    3,
+		LockoutAfter:    5,
+		BaseDelay:       time.Second,
+		LockoutDuration: time.Minute,
+	})
+	key := loginKey(" Jane@Example.com")
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		failures int
+		wait     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := throttle.Fail(key, now); got != tt.failures {
+			t.Fatalf("Fail() = %d, want %d", got, tt.failures)
+		}
+
+		if got := throttle.Wait(key, now); got != tt.wait {
+			t.Errorf("Wait() after %d failures = %v, want %v", tt.failures, got, tt.wait)
+		}
+	}
+
+	if !throttle.Locked(5) || throttle.Locked(4) || !throttle.BackingOff(3) {
+		t.Errorf("Locked()/BackingOff() don't match the policy")
+	}
+
+	// Keys are normalized and independent
+	if throttle.Wait(loginKey("jane@example.com"), now) == 0 {
+		t.Errorf("Wait() ignores case and spaces of the email")
+	}
+
+	if throttle.Wait(loginKey("john@example.com"), now) != 0 {
+		t.Errorf("Wait() of another account = %v", throttle.Wait(loginKey("john@example.com"), now))
+	}
+
+	// The lockout ends and the count starts over
+	later := now.Add(2 * time.Minute)
+
+	if throttle.Wait(key, later) != 0 || throttle.Fail(key, later) != 1 {
+		t.Errorf("failures weren't forgotten after the lockout")
+	}
+
+	throttle.Reset(key)
+
+	if throttle.Fail(key, later) != 1 {
+		t.Errorf("Reset() didn't forget the failures")
+	}
+}
+
+func TestLoginThrottleReservesAttempts(t *testing.T) {
+	policy := auth.ThrottlePolicy{
+		BackoffAfter:    3,
+		LockoutAfter:    5,
+		BaseDelay:       time.Second,
+		LockoutDuration: time.Minute,
+	}
+	throttle := auth.NewLoginThrottle(policy)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// Attempts still running count before their failures are recorded
+	for i := range 3 {
+		if _, ok := throttle.Acquire("a", now); !ok {
+			t.Fatalf("Acquire() #%d refused", i+1)
+		}
+	}
+
+	if wait, ok := throttle.Acquire("a", now); ok || wait != time.Second {
+		t.Errorf("Acquire() past the free attempts = %v, %v", wait, ok)
+	}
+
+	// Two attempts end, one failed: one more may start, not two
+	throttle.Release("a")
+	throttle.Fail("a", now)
+
+	if _, ok := throttle.Acquire("a", now); !ok {
+		t.Errorf("Acquire() with one failure and one attempt running refused")
+	}
+
+	if _, ok := throttle.Acquire("a", now); ok {
+		t.Errorf("Acquire() with one failure and two attempts running wasn't refused")
+	}
+
+	// A success forgets the failures but not the attempts still running
+	throttle.Reset("a")
+
+	if _, ok := throttle.Acquire("a", now); !ok {
+		t.Errorf("Acquire() after a success refused")
+	}
+
+	// A parallel burst gets no more than the free attempts in
+	burst := auth.NewLoginThrottle(policy)
+	acquired := atomic.Int32{}
+	wg := sync.WaitGroup{}
+
+	for range 50 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, ok := burst.Acquire("b", now); ok {
+				acquired.Add(1)
+				burst.Fail("b", now)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if acquired.Load() != int32(policy.BackoffAfter) {
+		t.Errorf("burst acquired %d attempts, want %d", acquired.Load(), policy.BackoffAfter)
+	}
+}
@@ -3,28 +3,63 @@ package main
 import (
 	"net/http"
 	"fmt"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"encoding/json"
-	"strings"
+	"errors"
+	"context"
+	"log"
 	_ "github.com/lib/pq"
-	"github.com/joho/godotenv"
 	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/FallenL3vi/WebServer/internal/mailer"
 	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/FallenL3vi/WebServer/internal/moderation"
+	"github.com/FallenL3vi/WebServer/internal/config"
+	"github.com/FallenL3vi/WebServer/internal/ratelimit"
+	"github.com/FallenL3vi/WebServer/internal/plans"
 	"database/sql"
+	"net/netip"
 	"os"
 	"github.com/google/uuid"
 	"time"
-	"sort"
+	"os/signal"
+	"syscall"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db *sql.DB
 	dbQueries *database.Queries
+	filter moderation.Filter
+	reportsToHide int
 	platform string
-	secretJWT string
+	jwtKeys *auth.KeySet
+	tokenVersions *auth.TokenVersionCache
 	polkaKey string
+	mailer mailer.Mailer
+	publicURL string
+	emailVerificationTTL time.Duration
+	passwordResetTTL time.Duration
+	passwordResetURL string
+	passwordResets chan string
+	passwordPolicy auth.PasswordPolicy
+	passwordHasher *auth.PasswordHasher
+	totpSecrets *auth.SecretBox
+	dummyPasswordHash string
+	accountThrottle *auth.LoginThrottle
+	ipThrottle *auth.LoginThrottle
+	trustedProxies []netip.Prefix
+	rateLimiter ratelimit.Store
+	rateLimitDefault ratelimit.Limit
+	rateLimits map[string]ratelimit.Limit
+	plans plans.Table
+	// Goroutines that outlive requests, main waits for them before it closes the database
+	background sync.WaitGroup
 }
 
+const refreshTokenTTL = 60*24*time.Hour
+
 type User struct {
 	ID uuid.UUID `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
@@ -33,6 +68,7 @@ type User struct {
 	Token string `json:"token"`
 	RefreshToken string `json:"refresh_token"`
 	IsChirpyRed bool `json:"is_chirpy_red"`
+	EmailVerified bool `json:"email_verified"`
 }
 
 type Post struct {
@@ -63,44 +99,18 @@ func (cfg *apiConfig) getRequests(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) restMiddlewareMetrics(w http.ResponseWriter, r *http.Request) {
 	if cfg.platform != "dev" {
 		respondWithError(w, 403, "ERROR Forbidden You don't have an access", nil)
+		return
 	}
 	cfg.fileserverHits.Swap(0)
-	w.WriteHeader(http.StatusOK)
 	err := cfg.dbQueries.DeleteUsers(r.Context())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "ERROR couldon't delete users", err)
 		return
 	}
+	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Hits reset to 0"))
 }
 
-func cleanBadWord(text string) string {
-
-	if len(text) == 0{
-		fmt.Println("Empty text or word to clean")
-		return ""
-	}
-
-	words := strings.Split(text, " ")
-
-	for index, word := range words {
-		var lowerStr string = strings.ToLower(word)
-		var asterix string = "****"
-		switch lowerStr {
-			case "kerfuffle":
-				words[index] = asterix
-			case "sharbert":
-				words[index] = asterix
-			case "fornax":
-				words[index] = asterix
-		}
-	}
-
-	var newStr string = strings.Join(words, " ")
-	return newStr
-}
-
-
 func (cfg *apiConfig) handlerUsers(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Email string `json:"email"`
@@ -117,19 +127,62 @@ func (cfg *apiConfig) handlerUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hash, err := auth.HashPassword(params.Password)
+	err = validateEmail(params.Email)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR "+err.Error(), err)
+		return
+	}
+
+	if !cfg.checkPassword(w, params.Password) {
+		return
+	}
+
+	hash, err := cfg.passwordHasher.Hash(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error", err)
 		return	
 	}
 
-	user, err := cfg.dbQueries.CreateUser(r.Context(), database.CreateUserParams{Email: params.Email, HashedPassword: hash,})
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	user, err := queries.CreateUser(r.Context(), database.CreateUserParams{Email: params.Email, HashedPassword: hash,})
 
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error couldn't create an user", err)
 		return
 	}
 
+	verificationToken, err := cfg.createVerificationToken(r.Context(), queries, user)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't create verification token", err)
+		return
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't create an user", err)
+		return
+	}
+
+	// The account exists either way, a failed email can be sent again
+	// through POST /api/users/verify/resend
+	err = cfg.sendVerificationEmail(r.Context(), user.Email, verificationToken)
+
+	if err != nil {
+		log.Printf("Error sending verification email to user %s: %s", user.ID, err)
+	}
+
 
 	var returnValue User = User{
 		ID: user.ID,
@@ -137,6 +190,7 @@ func (cfg *apiConfig) handlerUsers(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
 		IsChirpyRed: user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 
 	}
 
@@ -159,31 +213,55 @@ func(cfg *apiConfig) handleMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(params.Body) > 140 {
-		respondWithError(w, http.StatusBadRequest, "Is too long", nil)
+	userID, _, err := cfg.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
 		return
 	}
-	
 
-	token, err := auth.GetBearerToken(r.Header)
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "ERROR user doesn't exist", err)
+		return
+	}
 
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "ERROR couldn't get token from header", err)
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't get the user", err)
 		return
 	}
 
-	userID, err := auth.ValidateJWT(token, cfg.secretJWT)
+	if !user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusForbidden, "ERROR verify your email address before posting", nil)
+		return
+	}
+
+	plan := cfg.plans.For(user.IsChirpyRed)
+
+	moderated, err := cfg.validateChirp(params.Body, plan.MaxChirpLength)
 
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if !cfg.allowExtraRequest(w, r, "post|user:"+userID.String(), plan.PostRate) {
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
 		return
 	}
+	defer tx.Rollback()
 
-	//ADD VERIFICATION ON DATABASE TO CEHCK IF USER STILL EXISTS
-	var cleanText string = cleanBadWord(params.Body)
+	queries := cfg.dbQueries.WithTx(tx)
 
-	post, err := cfg.dbQueries.CreatePost(r.Context(), database.CreatePostParams{
-		Body: cleanText,
+	post, err := queries.CreatePost(r.Context(), database.CreatePostParams{
+		Body: moderated.Text,
 		UserID: userID,
 	})
 
@@ -192,6 +270,23 @@ func(cfg *apiConfig) handleMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Queue it in the same transaction so a flagged post is never listed
+	if moderated.Flagged {
+		err = flagForReview(r.Context(), queries, post.ID, moderated)
+
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "ERROR Couldn't queue the post for review", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR Couldn't create a post", err)
+		return
+	}
+
 	respondWithJSON(w, 201, Post{
 		ID: post.ID,
 		CreatedAt: post.CreatedAt,
@@ -204,55 +299,79 @@ func(cfg *apiConfig) handleMessage(w http.ResponseWriter, r *http.Request) {
 }
 
 func(cfg *apiConfig) handleGetPosts(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Chirps []Post `json:"chirps"`
+		NextCursor *string `json:"next_cursor"`
+	}
+
 	author_id := r.URL.Query().Get("author_id")
-	sortOrder := r.URL.Query().Get("sort")
 
-	var err error
+	postSort, err := parsePostSort(r.URL.Query().Get("sort_by"), r.URL.Query().Get("sort"))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR invalid sort", err)
+		return
+	}
+
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
 
-	posts := []database.Post{}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR invalid limit", err)
+		return
+	}
 
+	page := postPage{
+		Sort: postSort,
+		// Fetch one extra row to find out whether there is another page
+		Limit: int32(limit + 1),
+	}
 
 	if author_id != "" {
 		authorUUID, err := uuid.Parse(author_id)
 
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "ERROR  couldn't parse string", err)
+			respondWithError(w, http.StatusBadRequest, "ERROR  couldn't parse author_id", err)
+			return
 		}
+		page.AuthorID = uuid.NullUUID{UUID: authorUUID, Valid: true}
+	}
 
-		posts, err = cfg.dbQueries.GetUserPosts(r.Context(), authorUUID)
+	if rawCursor := r.URL.Query().Get("cursor"); rawCursor != "" {
+		cursor, err := decodeCursor(rawCursor)
 
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "ERROR Couldn't get posts", err)
+			respondWithError(w, http.StatusBadRequest, "ERROR invalid cursor", err)
 			return
 		}
-	} else {
-		posts, err = cfg.dbQueries.GetPosts(r.Context())
 
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "ERROR Couldn't get posts", err)
+		if cursor.SortKey != postSort.Key {
+			respondWithError(w, http.StatusBadRequest, "ERROR cursor doesn't match sort_by", nil)
 			return
 		}
+
+		page.Cursor = &cursor
 	}
 
-	returnPosts := []Post{}
+	posts, err := listPosts(r.Context(), cfg.dbQueries, page)
 
-	if sortOrder == "desc" {
-		sort.Slice(posts, func(i, j int) bool {
-			return posts[i].CreatedAt.After(posts[j].CreatedAt)
-		})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR Couldn't get posts", err)
+		return
 	}
 
-	for _, post := range posts {
-		returnPosts = append(returnPosts, Post{
-			ID: post.ID,
-			CreatedAt: post.CreatedAt,
-			UpdatedAt: post.UpdatedAt,
-			Body: post.Body,
-			UserID: post.UserID,
-		})
+	var nextCursor *string
+
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[len(posts)-1]
+		encoded := encodeCursor(cursorForPost(last, postSort.Key))
+		nextCursor = &encoded
 	}
 
-	respondWithJSON(w, http.StatusOK, returnPosts)
+	respondWithJSON(w, http.StatusOK, response{
+		Chirps: posts,
+		NextCursor: nextCursor,
+	})
 }
 
 func(cfg *apiConfig) handleGetSinglePost(w http.ResponseWriter, r *http.Request) {
@@ -269,7 +388,7 @@ func(cfg *apiConfig) handleGetSinglePost(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	post, err := cfg.dbQueries.GetPost(r.Context(), newUUID)
+	post, err := cfg.dbQueries.GetVisiblePost(r.Context(), newUUID)
 
 	if err != nil {
 		respondWithError(w, 404, "ERROR  couldn't find the post", err)
@@ -300,23 +419,87 @@ func(cfg *apiConfig) handleLoginUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var expiresInSeconds int = 3600 //1h
+	accountKey := loginKey(params.Email)
+	ip := cfg.clientIP(r)
+
+	attempt, wait := cfg.startLogin(accountKey, ip)
+
+	if attempt == nil {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	defer attempt.release()
 
 	user, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
+	userExists := err == nil
 
-	if err != nil {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		respondWithError(w, http.StatusInternalServerError, "Error couldn't get the user", err)
 		return
 	}
 
-	err = auth.CheckPasswordHash(user.HashedPassword, params.Password)
+	// Unknown emails are checked against a dummy hash so both cases take
+	// as long and get the same answer
+	hashedPassword := cfg.dummyPasswordHash
 
-	if err != nil {
+	if userExists {
+		hashedPassword = user.HashedPassword
+	}
+
+	err = cfg.passwordHasher.Check(hashedPassword, params.Password)
+
+	if err != nil || !userExists {
+		attempt.failed()
 		respondWithError(w, 401, "ERROR UNAUTHORIZED ACCESS", err)
 		return
 	}
 
-	token, err := auth.MakeJWT(user.ID, cfg.secretJWT, time.Duration(expiresInSeconds)*time.Second)
+	attempt.succeeded()
+
+	// Only now is the password known, so bcrypt hashes and hashes with old
+	// Argon2id parameters are replaced one login at a time
+	if cfg.passwordHasher.NeedsRehash(user.HashedPassword) {
+		cfg.rehashPassword(r.Context(), user, params.Password)
+	}
+
+	mfaRequired, err := cfg.mfaEnabled(r.Context(), user.ID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't check two factor authentication", err)
+		return
+	}
+
+	// The password alone isn't enough, the client has to send a code to
+	// POST /api/login/mfa
+	if mfaRequired {
+		mfaToken, err := cfg.jwtKeys.MakeMFAToken(user.ID, mfaTokenTTL)
+
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "ERROR couldn't make JWT", err)
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, mfaChallenge{MFARequired: true, MFAToken: mfaToken})
+		return
+	}
+
+	cfg.respondWithSession(w, r, user)
+}
+
+// respondWithSession signs the user in with a new access and refresh token
+func(cfg *apiConfig) respondWithSession(w http.ResponseWriter, r *http.Request, user database.User) {
+	var expiresInSeconds int = 3600 //1h
+
+	// A login starts a new session. Every refresh token rotated from this
+	// one inherits the family ID, which doubles as the session ID.
+	sessionID := uuid.New()
+
+	token, err := cfg.jwtKeys.MakeJWT(auth.AccessToken{
+		UserID: user.ID,
+		Role: user.Role,
+		SessionID: sessionID,
+		Version: user.TokenVersion,
+	}, time.Duration(expiresInSeconds)*time.Second)
 
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't make JWT", err)
@@ -326,10 +509,18 @@ func(cfg *apiConfig) handleLoginUser(w http.ResponseWriter, r *http.Request) {
 
 	refreshToken, err := auth.MakeRefreshToken()
 
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't make Refresh Token", err)
+		return
+	}
+
 	_, err = cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token: refreshToken,
-		ExpiresAt: time.Now().UTC().Add(60*24*time.Hour),
+		TokenHash: auth.HashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
 		UserID: user.ID,
+		FamilyID: sessionID,
+		UserAgent: userAgent(r),
+		IpAddress: cfg.clientIP(r),
 	})
 
 	if err != nil {
@@ -345,14 +536,15 @@ func(cfg *apiConfig) handleLoginUser(w http.ResponseWriter, r *http.Request) {
 		Token: token,
 		RefreshToken: refreshToken,
 		IsChirpyRed: user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
 
 	})
-
 }
 
 func(cfg *apiConfig) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
 	type responseParams struct {
 		Token string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
 	}
 
 	tokenHeader, err := auth.GetBearerToken(r.Header)
@@ -362,26 +554,104 @@ func(cfg *apiConfig) handleRefreshToken(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	tokenRefresh, err := cfg.dbQueries.GetRefreshToken(r.Context(), tokenHeader)
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
 
 	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	// Checking and revoking the token in one statement means two requests
+	// can't both rotate the same token
+	tokenRefresh, err := queries.ConsumeRefreshToken(r.Context(), auth.HashRefreshToken(tokenHeader))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.detectRefreshTokenReuse(r.Context(), auth.HashRefreshToken(tokenHeader))
 		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG REFRESH TOKEN ACCESS DENIED", err)
 		return
 	}
 
-	token, err := auth.MakeJWT(tokenRefresh.UserID, cfg.secretJWT, time.Hour,)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't get Refresh Token", err)
+		return
+	}
+
+	user, err := queries.GetUserByID(r.Context(), tokenRefresh.UserID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't get the user", err)
+		return
+	}
+
+	refreshToken, err := auth.MakeRefreshToken()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't make Refresh Token", err)
+		return
+	}
+
+	_, err = queries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().UTC().Add(refreshTokenTTL),
+		UserID: user.ID,
+		FamilyID: tokenRefresh.FamilyID,
+		UserAgent: tokenRefresh.UserAgent,
+		IpAddress: tokenRefresh.IpAddress,
+	})
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't save Refresh Token", err)
+		return
+	}
+
+	token, err := cfg.jwtKeys.MakeJWT(auth.AccessToken{
+		UserID: user.ID,
+		Role: user.Role,
+		SessionID: tokenRefresh.FamilyID,
+		Version: user.TokenVersion,
+	}, time.Hour)
 
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't make JWT", err)
 		return
 	}
 
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't save Refresh Token", err)
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, responseParams{
 		Token: token,
+		RefreshToken: refreshToken,
 	})
 
 }
 
+// detectRefreshTokenReuse revokes the whole token family when a refresh
+// token that was already rotated is presented again. Either the legitimate
+// client or an attacker holds a stolen copy, so neither may keep the session.
+func(cfg *apiConfig) detectRefreshTokenReuse(ctx context.Context, tokenHash string) {
+	tokenRefresh, err := cfg.dbQueries.LookupRefreshToken(ctx, tokenHash)
+
+	if err != nil || !tokenRefresh.RevokedAt.Valid {
+		return
+	}
+
+	log.Printf("Revoked refresh token reused, revoking token family %s of user %s", tokenRefresh.FamilyID, tokenRefresh.UserID)
+
+	err = cfg.dbQueries.RevokeRefreshTokenFamily(ctx, tokenRefresh.FamilyID)
+
+	if err != nil {
+		log.Printf("Error revoking token family %s: %s", tokenRefresh.FamilyID, err)
+	}
+}
+
 func(cfg *apiConfig) handleRefreshRevoke(w http.ResponseWriter, r *http.Request) {
 	tokenHeader, err := auth.GetBearerToken(r.Header)
 
@@ -390,7 +660,7 @@ func(cfg *apiConfig) handleRefreshRevoke(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = cfg.dbQueries.SetRevokeAt(r.Context(), tokenHeader)
+	err = cfg.dbQueries.SetRevokeAt(r.Context(), auth.HashRefreshToken(tokenHeader))
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "ERROR COULDN'T REVOKE SESSION", err)
 		return
@@ -400,9 +670,7 @@ func(cfg *apiConfig) handleRefreshRevoke(w http.ResponseWriter, r *http.Request)
 }
 
 func(cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
-	accessToken, err := auth.GetBearerToken(r.Header)
-
-	userID, err := auth.ValidateJWT(accessToken, cfg.secretJWT)
+	userID, claims, err := cfg.authenticate(r)
 
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
@@ -421,6 +689,8 @@ func(cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt time.Time `json:"updated_at"`
 		Email string `json:"email"`
 		IsChirpyRed bool `json:"is_chirpy_red"`
+		EmailVerified bool `json:"email_verified"`
+		Token string `json:"token"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -432,14 +702,35 @@ func(cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	err = validateEmail(params.Email)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR "+err.Error(), err)
+		return
+	}
+
+	if !cfg.checkPassword(w, params.Password) {
+		return
+	}
+
+	hashedPassword, err := cfg.passwordHasher.Hash(params.Password)
 
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error couldn't hash the password", err)
 		return
 	}
 
-	user, err := cfg.dbQueries.UpdateUserPasswordAndEmail(r.Context(), database.UpdateUserPasswordAndEmailParams{
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	user, err := queries.UpdateUserPasswordAndEmail(r.Context(), database.UpdateUserPasswordAndEmailParams{
 		HashedPassword: hashedPassword,
 		Email: params.Email,
 		ID: userID,
@@ -449,20 +740,74 @@ func(cfg *apiConfig) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Error couldn't update the user", err)
 		return
 	}
-	
+
+	// Whoever knew the old password may still be signed in elsewhere, only
+	// the session that made the change stays signed in
+	err = revokeOtherSessions(r.Context(), queries, userID, claims)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR COULDN'T REVOKE SESSIONS", err)
+		return
+	}
+
+	// Changing the email resets the verification
+	verificationToken := ""
+
+	if !user.EmailVerifiedAt.Valid {
+		verificationToken, err = cfg.createVerificationToken(r.Context(), queries, user)
+
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "ERROR couldn't create verification token", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't update the user", err)
+		return
+	}
+
+	// The update bumped the token version, which revoked every access token
+	// including the one of this request. The current session gets a new one.
+	cfg.tokenVersions.Set(userID, user.TokenVersion)
+
+	if verificationToken != "" {
+		err = cfg.sendVerificationEmail(r.Context(), user.Email, verificationToken)
+
+		if err != nil {
+			log.Printf("Error sending verification email to user %s: %s", user.ID, err)
+		}
+	}
+
+	sessionID, _ := uuid.Parse(claims.SessionID)
+
+	token, err := cfg.jwtKeys.MakeJWT(auth.AccessToken{
+		UserID: user.ID,
+		Role: user.Role,
+		SessionID: sessionID,
+		Version: user.TokenVersion,
+	}, time.Hour)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't make JWT", err)
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, returnParams{
 		ID: userID,
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 		Email: user.Email,
 		IsChirpyRed: user.IsChirpyRed,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		Token: token,
 	})
 }
 
 func(cfg *apiConfig) handleDeletePost(w http.ResponseWriter, r *http.Request) {
-	accessToken, err := auth.GetBearerToken(r.Header)
-
-	userID, err := auth.ValidateJWT(accessToken, cfg.secretJWT)
+	userID, _, err := cfg.authenticate(r)
 
 	if err != nil {
 		respondWithError(w, 401, "ERROR WRONG JWT ACCESS DENIED", err)
@@ -487,13 +832,16 @@ func(cfg *apiConfig) handleDeletePost(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		respondWithError(w, 404, "ERRPR COULDN'T FIND THE POST", err)
+		return
 	}
 
 	if post.UserID != userID {
 		respondWithError(w, 403, "ERROR UNAUTHORIZED ACCESS", nil)
+		return
 	}
 
-	
+	// Only marks the post as deleted, purgeDeletedPosts removes it for good
+	// once the retention period is over
 	results, err := cfg.dbQueries.DeletePost(r.Context(), database.DeletePostParams {
 		ID: PostUUID,
 		UserID: userID,
@@ -519,86 +867,202 @@ func(cfg *apiConfig) handleDeletePost(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(204)
 }
 
-func(cfg *apiConfig) handleUpgradeUser(w http.ResponseWriter, r *http.Request) {
-	polkaKey, err := auth.GetAPIKey(r.Header)
+ 
+func main() {
+	conf, args, err := config.Load(os.Args[1:])
 
 	if err != nil {
-		respondWithError(w, 401, "ERROR Couldn't exxtract API KEY", err)
-		return
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	if polkaKey  != cfg.polkaKey {
-		respondWithError(w, 401, "ERROR AUTHENTICATION FAILED", err)
-		return
+	//Open connection to database
+	db, err := sql.Open("postgres", conf.DBURL)
+
+	if err != nil {
+		log.Fatalf("Couldn't open the database: %s", err)
 	}
+	defer db.Close()
 
-	type parameters struct {
-		Event string `json:"event"`
-		Data struct {
-			UserID uuid.UUID `json:"user_id"`
-		} `json:"data"`
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), 5*time.Second)
+	err = db.PingContext(pingCtx)
+	cancelPing()
+
+	if err != nil {
+		log.Fatalf("Couldn't connect to the database: %s", err)
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := parameters{}
-	err = decoder.Decode(&params)
+	// Cancelled on SIGINT/SIGTERM, stops the background jobs and the server
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jwtKeys := auth.NewKeySet(auth.NewHMACKey("", conf.SecretJWT))
+
+	if conf.JWTKeysDir != "" {
+		legacySecret := ""
+
+		if conf.JWTAcceptHS256 {
+			legacySecret = conf.SecretJWT
+		}
+
+		jwtKeys, err = auth.LoadKeySet(conf.JWTKeysDir, conf.JWTSigningKeyID, legacySecret)
+
+		if err != nil {
+			log.Fatalf("Couldn't load JWT signing keys: %s", err)
+		}
+	}
+
+	totpKey, err := auth.ParseSecretKey(conf.TOTPEncryptionKey)
 
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error decoding parameters:", err)
-		return
+		log.Fatalf("Couldn't read TOTP_ENCRYPTION_KEY: %s", err)
 	}
 
-	if params.Event != "user.upgraded" {
-		w.WriteHeader(204)
-		return
+	totpSecrets, err := auth.NewSecretBox(totpKey)
+
+	if err != nil {
+		log.Fatalf("Couldn't read TOTP_ENCRYPTION_KEY: %s", err)
 	}
 
-	resultSQL, err := cfg.dbQueries.UpgradeUser(r.Context(), database.UpgradeUserParams{
-		IsChirpyRed: true,
-		ID: params.Data.UserID,
-	})
+	cfg := apiConfig{
+		fileserverHits: atomic.Int32{},
+		db: db,
+		dbQueries: database.New(db),
+		platform: conf.Platform,
+		reportsToHide: conf.ReportsToHide,
+		jwtKeys: jwtKeys,
+		polkaKey: conf.PolkaKey,
+		publicURL: conf.PublicURL,
+		emailVerificationTTL: conf.EmailVerificationTTL,
+		passwordResetTTL: conf.PasswordResetTTL,
+		passwordResetURL: conf.PasswordResetURL,
+		passwordPolicy: auth.PasswordPolicy{
+			MinLength: conf.PasswordMinLength,
+			MaxBytes: conf.PasswordMaxBytes,
+			MinClasses: conf.PasswordMinClasses,
+		},
+		passwordHasher: &auth.PasswordHasher{Params: auth.Argon2Params{
+			Memory: uint32(conf.Argon2Memory),
+			Iterations: uint32(conf.Argon2Iterations),
+			Parallelism: uint8(conf.Argon2Parallelism),
+			SaltLength: 16,
+			KeyLength: 32,
+		}},
+		accountThrottle: auth.NewLoginThrottle(auth.ThrottlePolicy{
+			BackoffAfter: conf.LoginAccountBackoffAfter,
+			LockoutAfter: conf.LoginAccountLockoutAfter,
+			BaseDelay: conf.LoginBackoffBase,
+			LockoutDuration: conf.LoginLockoutDuration,
+		}),
+		ipThrottle: auth.NewLoginThrottle(auth.ThrottlePolicy{
+			BackoffAfter: conf.LoginIPBackoffAfter,
+			LockoutAfter: conf.LoginIPLockoutAfter,
+			BaseDelay: conf.LoginBackoffBase,
+			LockoutDuration: conf.LoginLockoutDuration,
+		}),
+		totpSecrets: totpSecrets,
+		trustedProxies: conf.TrustedProxies,
+		rateLimiter: ratelimit.NewMemoryStore(),
+		rateLimitDefault: conf.RateLimitDefault,
+		rateLimits: conf.RateLimits,
+		plans: conf.Plans,
+	}
+
+	cfg.dummyPasswordHash, err = cfg.passwordHasher.Hash(uuid.NewString())
 
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error Couldn't upgrade the user", err)
+		log.Fatalf("Couldn't hash the dummy password: %s", err)
+	}
+
+	if conf.BreachedPasswordsFile != "" {
+		cfg.passwordPolicy.Breached, err = auth.LoadBreachedPasswords(conf.BreachedPasswordsFile)
+
+		if err != nil {
+			log.Fatalf("Couldn't load breached passwords: %s", err)
+		}
+		log.Printf("Loaded %d breached password hashes", cfg.passwordPolicy.Breached.Len())
+	}
+
+	if conf.SMTPAddr != "" {
+		cfg.mailer = &mailer.SMTPMailer{
+			Addr: conf.SMTPAddr,
+			Username: conf.SMTPUsername,
+			Password: conf.SMTPPassword,
+			From: conf.MailFrom,
+		}
+	} else if conf.MailDir != "" {
+		cfg.mailer = &mailer.FileMailer{Dir: conf.MailDir, From: conf.MailFrom}
+	} else {
+		// Only allowed on the dev platform, the log gets every verification and reset link
+		cfg.mailer = mailer.LogMailer{}
+	}
+
+	if cfg.passwordResetURL == "" {
+		cfg.passwordResetURL = strings.TrimSuffix(conf.PublicURL, "/") + "/app/reset-password/"
+	}
+
+	cfg.tokenVersions = auth.NewTokenVersionCache(conf.TokenVersionCacheTTL, cfg.dbQueries.GetUserTokenVersion)
+
+	// Subcommands run against the database instead of starting the server
+	if len(args) > 0 {
+		err = runCommand(ctx, cfg.dbQueries, args)
+
+		if err != nil {
+			log.Fatal(err)
+		}
 		return
 	}
 
-	rowsAffected, err := resultSQL.RowsAffected()
+	sealed, err := sealPlaintextTOTPSecrets(ctx, cfg.dbQueries, cfg.totpSecrets)
 
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "ERROR  checking affected rows", err)
-		return
+		log.Fatalf("Couldn't encrypt TOTP secrets: %s", err)
 	}
 
-	if rowsAffected == 0 {
-		respondWithError(w, 404, "ERROR  USER WAS NOT FOUND OR UNAUTHORIZED", err)
-		return
+	if sealed > 0 {
+		log.Printf("Encrypted %d TOTP secrets stored in plaintext", sealed)
 	}
-	
-	w.WriteHeader(204)
-}
- 
-func main() {
-	//Load and get enviorment variable DB_URL
-	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	platform := os.Getenv("PLATFORM")
 
-	//Open connection to database
-	db, err := sql.Open("postgres", dbURL)
+	var wordSource moderation.Source = bannedWordsSource(cfg.dbQueries)
 
+	if conf.BannedWordsFile != "" {
+		wordSource = moderation.FileSource{Path: conf.BannedWordsFile}
+	}
 
-	cfg := apiConfig{
-		fileserverHits: atomic.Int32{},
-		dbQueries: database.New(db),
-		platform: platform,
-		secretJWT: os.Getenv("SECRET_JWT"),
-		polkaKey: os.Getenv("POLKA_KEY"),
+	filter, err := moderation.NewWordFilter(ctx, wordSource)
+
+	if err != nil {
+		log.Fatalf("Couldn't load banned words: %s", err)
 	}
+	cfg.filter = filter
+
+	cfg.startJob(ctx, conf.BannedWordsReloadInterval, func(ctx context.Context) {
+		err := filter.Reload(ctx)
+
+		if err != nil {
+			log.Printf("Error reloading banned words: %s", err)
+		}
+	})
+
+	cfg.startJob(ctx, conf.PurgeInterval, func(ctx context.Context) {
+		cfg.purgeDeletedPosts(ctx, conf.ChirpRetention)
+	})
+
+	cfg.startJob(ctx, conf.SubscriptionExpiryInterval, cfg.expireSubscriptions)
+
+	// Stopped after the server, requests still draining can queue emails
+	resetsCtx, stopResets := context.WithCancel(context.Background())
+	cfg.startPasswordResetWorkers(resetsCtx)
 
 	mux := http.NewServeMux()
-	server := http.Server{}
-	server.Addr =":8080"
+	server := http.Server{
+		Addr: conf.Addr,
+		ReadTimeout: conf.ReadTimeout,
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		WriteTimeout: conf.WriteTimeout,
+		IdleTimeout: conf.IdleTimeout,
+		MaxHeaderBytes: conf.MaxHeaderBytes,
+	}
 	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
@@ -607,37 +1071,90 @@ func main() {
 
 	})
 
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.handleJWKS)
+
 	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(".")))))
 	
-	mux.HandleFunc("GET /admin/metrics", cfg.getRequests)
+	// Every /admin route needs a staff role, resetting the database needs an admin
+	requireStaff := cfg.middlewareRequireRole(auth.RoleAdmin, auth.RoleModerator)
+	requireAdmin := cfg.middlewareRequireRole(auth.RoleAdmin)
+
+	mux.Handle("GET /admin/metrics", requireStaff(http.HandlerFunc(cfg.getRequests)))
+
+	mux.Handle("POST /admin/reset", requireAdmin(http.HandlerFunc(cfg.restMiddlewareMetrics)))
 
-	mux.HandleFunc("POST /admin/reset", cfg.restMiddlewareMetrics)
+	mux.Handle("POST /admin/chirps/{chirpID}/restore", requireStaff(http.HandlerFunc(cfg.handleRestorePost)))
+
+	mux.Handle("GET /admin/moderation", requireStaff(http.HandlerFunc(cfg.handleListModeration)))
+
+	mux.Handle("POST /admin/moderation/{itemID}/approve", requireStaff(http.HandlerFunc(cfg.handleApproveModeration)))
+
+	mux.Handle("POST /admin/moderation/{itemID}/remove", requireStaff(http.HandlerFunc(cfg.handleRemoveModeration)))
+
+	mux.Handle("GET /admin/webhooks/events", requireAdmin(http.HandlerFunc(cfg.handleListWebhookEvents)))
+
+	mux.Handle("POST /admin/webhooks/events/{eventID}/replay", requireAdmin(http.HandlerFunc(cfg.handleReplayWebhookEvent)))
 
 	mux.HandleFunc("POST /api/users",  cfg.handlerUsers)
 
+	mux.HandleFunc("GET /api/users/verify", cfg.handleVerifyEmail)
+
+	mux.HandleFunc("POST /api/users/verify/resend", cfg.handleResendVerification)
+
 	mux.HandleFunc("POST /api/chirps", cfg.handleMessage)
 
+	mux.HandleFunc("GET /api/chirps/search", cfg.handleSearchPosts)
+
 	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.handleGetSinglePost)
 
 	mux.HandleFunc("GET /api/chirps", cfg.handleGetPosts)
 
 	mux.HandleFunc("POST /api/login", cfg.handleLoginUser)
 
+	mux.HandleFunc("POST /api/login/mfa", cfg.handleLoginMFA)
+
+	mux.HandleFunc("POST /api/mfa/totp/enroll", cfg.handleEnrollTOTP)
+
+	mux.HandleFunc("POST /api/mfa/totp/confirm", cfg.handleConfirmTOTP)
+
+	mux.HandleFunc("POST /api/mfa/totp/disable", cfg.handleDisableTOTP)
+
+	mux.HandleFunc("POST /api/password/forgot", cfg.handleForgotPassword)
+
+	mux.HandleFunc("POST /api/password/reset", cfg.handleResetPassword)
+
 	mux.HandleFunc("POST /api/refresh", cfg.handleRefreshToken)
 
 	mux.HandleFunc("POST /api/revoke", cfg.handleRefreshRevoke)
 
+	mux.HandleFunc("GET /api/sessions", cfg.handleListSessions)
+
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.handleRevokeSession)
+
+	mux.HandleFunc("POST /api/sessions/revoke-all", cfg.handleRevokeAllSessions)
+
 	mux.HandleFunc("PUT /api/users", cfg.handleUpdateUser)
 
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.handleUpdatePost)
+
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", cfg.handleGetPostRevisions)
+
+	mux.HandleFunc("POST /api/chirps/{chirpID}/report", cfg.handleReportPost)
+
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.handleDeletePost)
 
-	mux.HandleFunc("POST /api/polka/webhooks", cfg.handleUpgradeUser)
+	mux.HandleFunc("POST /api/polka/webhooks", cfg.handlePolkaWebhook)
 
-	server.Handler = mux
+	server.Handler = cfg.middlewareRateLimit(mux)
 
-	err = server.ListenAndServe()
+	err = runServer(ctx, &server, conf.ShutdownTimeout)
 
 	if err != nil {
 		fmt.Println("Server error:", err)
 	}
+
+	// The server can also stop on its own, the jobs only stop on cancel
+	stop()
+	stopResets()
+	cfg.background.Wait()
 }
\ No newline at end of file
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer        = "Chirpy"
+	mfaTokenTTL       = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// mfaChallenge is the answer to a correct password when the account has
+// two factor authentication on
+type mfaChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+func (cfg *apiConfig) mfaEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	credential, err := cfg.dbQueries.GetTOTPCredential(ctx, userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return credential.ConfirmedAt.Valid, nil
+}
+
+// totpSecret decrypts the secret of credential
+func (cfg *apiConfig) totpSecret(credential database.TotpCredential) (string, error) {
+	return cfg.totpSecrets.Open(credential.Secret, credential.UserID.String())
+}
+
+var errWrongTOTPCode = errors.New("wrong code")
+
+// validateAndUseTOTP accepts a code of the authenticator app once
+func validateAndUseTOTP(ctx context.Context, queries *database.Queries, credential database.TotpCredential, secret, code string) error {
+	step, err := auth.ValidateTOTP(secret, code, time.Now(), credential.LastUsedStep)
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", errWrongTOTPCode, err)
+	}
+
+	// Two requests with the same code race here, only one moves the step
+	// forward
+	used, err := queries.UseTOTPStep(ctx, database.UseTOTPStepParams{
+		UserID:       credential.UserID,
+		LastUsedStep: step,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if used == 0 {
+		return errors.New("code was already used")
+	}
+
+	return nil
+}
+
+// verifySecondFactor accepts either a code of the authenticator app or an
+// unused recovery code, and burns it
+func (cfg *apiConfig) verifySecondFactor(ctx context.Context, queries *database.Queries, credential database.TotpCredential, code string) error {
+	code = strings.TrimSpace(code)
+
+	secret, err := cfg.totpSecret(credential)
+
+	// Recovery codes still work when the secret can't be decrypted
+	if err != nil {
+		log.Printf("Error decrypting the TOTP secret of %s: %s", credential.UserID, err)
+	} else {
+		err = validateAndUseTOTP(ctx, queries, credential, secret, code)
+
+		if err == nil || !errors.Is(err, errWrongTOTPCode) {
+			return err
+		}
+	}
+
+	used, err := queries.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   credential.UserID,
+		CodeHash: auth.HashToken(auth.NormalizeRecoveryCode(code)),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if used == 0 {
+		return errors.New("invalid code")
+	}
+
+	return nil
+}
+
+func (cfg *apiConfig) handleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters:", err)
+		return
+	}
+
+	userID, err := cfg.jwtKeys.ParseMFAToken(params.MFAToken)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR invalid or expired MFA token, log in again", err)
+		return
+	}
+
+	// Codes are short, guessing them is throttled like passwords
+	accountKey := "mfa:" + userID.String()
+	ip := cfg.clientIP(r)
+
+	attempt, wait := cfg.startLogin(accountKey, ip)
+
+	if attempt == nil {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	defer attempt.release()
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	credential, err := queries.GetTOTPCredential(r.Context(), userID)
+
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !credential.ConfirmedAt.Valid) {
+		respondWithError(w, http.StatusUnauthorized, "ERROR two factor authentication is off, log in again", err)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't check two factor authentication", err)
+		return
+	}
+
+	err = cfg.verifySecondFactor(r.Context(), queries, credential, params.Code)
+
+	if err != nil {
+		attempt.failed()
+		respondWithError(w, http.StatusUnauthorized, "ERROR UNAUTHORIZED ACCESS", err)
+		return
+	}
+
+	attempt.succeeded()
+
+	user, err := queries.GetUserByID(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't get the user", err)
+		return
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't check two factor authentication", err)
+		return
+	}
+
+	cfg.respondWithSession(w, r, user)
+}
+
+// checkCurrentPassword makes sure a change to two factor authentication
+// comes from someone who knows the password, an access token alone isn't
+// enough. Wrong passwords count as failed logins of the account.
+func (cfg *apiConfig) checkCurrentPassword(w http.ResponseWriter, r *http.Request, user database.User, password string) bool {
+	accountKey := loginKey(user.Email)
+	ip := cfg.clientIP(r)
+
+	attempt, wait := cfg.startLogin(accountKey, ip)
+
+	if attempt == nil {
+		respondTooManyAttempts(w, wait)
+		return false
+	}
+	defer attempt.release()
+
+	err := cfg.passwordHasher.Check(user.HashedPassword, password)
+
+	if err != nil {
+		attempt.failed()
+		respondWithError(w, http.StatusUnauthorized, "ERROR wrong password", err)
+		return false
+	}
+
+	return true
+}
+
+func (cfg *apiConfig) handleEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	type response struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	}
+
+	userID, _, err := cfg.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters:", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't get the user", err)
+		return
+	}
+
+	if !cfg.checkCurrentPassword(w, r, user, params.Password) {
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't generate a secret", err)
+		return
+	}
+
+	sealed, err := cfg.totpSecrets.Seal(secret, userID.String())
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't encrypt the secret", err)
+		return
+	}
+
+	// Enrolling again before confirming replaces the secret
+	_, err = cfg.dbQueries.StartTOTPEnrollment(r.Context(), database.StartTOTPEnrollmentParams{
+		UserID: userID,
+		Secret: sealed,
+	})
+
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusConflict, "ERROR two factor authentication is already on", err)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't save the secret", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(totpIssuer, user.Email, secret),
+	})
+}
+
+func (cfg *apiConfig) handleConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+
+	userID, _, err := cfg.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters:", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't get the user", err)
+		return
+	}
+
+	if !cfg.checkCurrentPassword(w, r, user, params.Password) {
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	credential, err := queries.GetTOTPCredential(r.Context(), userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "ERROR enroll with POST /api/mfa/totp/enroll first", err)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't check two factor authentication", err)
+		return
+	}
+
+	if credential.ConfirmedAt.Valid {
+		respondWithError(w, http.StatusConflict, "ERROR two factor authentication is already on", nil)
+		return
+	}
+
+	secret, err := cfg.totpSecret(credential)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't decrypt the secret", err)
+		return
+	}
+
+	// Proves the authenticator app has the secret before logins need it
+	step, err := auth.ValidateTOTP(secret, params.Code, time.Now(), 0)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR invalid code", err)
+		return
+	}
+
+	err = queries.ConfirmTOTPCredential(r.Context(), database.ConfirmTOTPCredentialParams{
+		UserID:       userID,
+		LastUsedStep: step,
+	})
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't turn on two factor authentication", err)
+		return
+	}
+
+	codes, err := replaceRecoveryCodes(r.Context(), queries, userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't create recovery codes", err)
+		return
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't turn on two factor authentication", err)
+		return
+	}
+
+	// The only time the codes are shown, only their hashes are stored
+	respondWithJSON(w, http.StatusOK, response{RecoveryCodes: codes})
+}
+
+func replaceRecoveryCodes(ctx context.Context, queries *database.Queries, userID uuid.UUID) ([]string, error) {
+	err := queries.DeleteRecoveryCodes(ctx, userID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		err = queries.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashToken(code),
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, nil
+}
+
+func (cfg *apiConfig) handleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+
+	userID, _, err := cfg.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters:", err)
+		return
+	}
+
+	// Codes are guessed against the same throttle as MFA logins, before
+	// anything else is looked up
+	attempt, wait := cfg.startLogin("mfa:"+userID.String(), cfg.clientIP(r))
+
+	if attempt == nil {
+		respondTooManyAttempts(w, wait)
+		return
+	}
+	defer attempt.release()
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't get the user", err)
+		return
+	}
+
+	if !cfg.checkCurrentPassword(w, r, user, params.Password) {
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	credential, err := queries.GetTOTPCredential(r.Context(), userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "ERROR two factor authentication is off", err)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't check two factor authentication", err)
+		return
+	}
+
+	// A stolen access token alone mustn't be enough to turn it off. An
+	// enrollment that was never confirmed can be cancelled without a code.
+	if credential.ConfirmedAt.Valid {
+		err = cfg.verifySecondFactor(r.Context(), queries, credential, params.Code)
+
+		if err != nil {
+			attempt.failed()
+			respondWithError(w, http.StatusUnauthorized, "ERROR UNAUTHORIZED ACCESS", err)
+			return
+		}
+	}
+
+	err = queries.DeleteTOTPCredential(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't turn off two factor authentication", err)
+		return
+	}
+
+	err = queries.DeleteRecoveryCodes(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't turn off two factor authentication", err)
+		return
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't turn off two factor authentication", err)
+		return
+	}
+
+	attempt.succeeded()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sealPlaintextTOTPSecrets encrypts the TOTP secrets stored before they were
+// encrypted and returns how many there were
+func sealPlaintextTOTPSecrets(ctx context.Context, queries *database.Queries, box *auth.SecretBox) (int, error) {
+	credentials, err := queries.ListPlaintextTOTPSecrets(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, credential := range credentials {
+		sealed, err := box.Seal(credential.Secret, credential.UserID.String())
+
+		if err != nil {
+			return 0, err
+		}
+
+		// Re-enrolling in the meantime already stored an encrypted secret
+		_, err = queries.SealTOTPSecret(ctx, database.SealTOTPSecretParams{
+			Sealed:    sealed,
+			UserID:    credential.UserID,
+			Plaintext: credential.Secret,
+		})
+
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(credentials), nil
+}
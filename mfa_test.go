@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/google/uuid"
+)
+
+// Base32 of the RFC 6238 SHA-1 test secret "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// The last 6 digits of the 8 digit codes in RFC 6238 appendix B
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := auth.TOTPCode(rfcSecret, auth.TOTPStep(time.Unix(tt.unix, 0)))
+
+		if err != nil || got != tt.want {
+			t.Errorf("TOTPCode(%d) = %q, %v, want %q", tt.unix, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := auth.TOTPStep(now)
+
+	previous, _ := auth.TOTPCode(rfcSecret, step-1)
+
+	got, err := auth.ValidateTOTP(rfcSecret, previous, now, 0)
+
+	if err != nil || got != step-1 {
+		t.Errorf("ValidateTOTP() previous step = %d, %v", got, err)
+	}
+
+	// A code is only good once
+	if _, err := auth.ValidateTOTP(rfcSecret, previous, now, step-1); err == nil {
+		t.Errorf("ValidateTOTP() accepted a used code")
+	}
+
+	old, _ := auth.TOTPCode(rfcSecret, step-5)
+
+	if _, err := auth.ValidateTOTP(rfcSecret, old, now, 0); err == nil {
+		t.Errorf("ValidateTOTP() accepted a code of 2.5 minutes ago")
+	}
+
+	if _, err := auth.ValidateTOTP(rfcSecret, "12345", now, 0); err == nil {
+		t.Errorf("ValidateTOTP() accepted a short code")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	secret, _ := auth.GenerateTOTPSecret()
+	uri, err := url.Parse(auth.TOTPURI("Chirpy", "jane@example.com", secret))
+
+	if err != nil {
+		t.Fatalf("TOTPURI() error = %v", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Chirpy:jane@example.com" || uri.Query().Get("secret") != secret {
+		t.Errorf("TOTPURI() = %v", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := auth.GenerateRecoveryCodes(10)
+
+	if err != nil || len(codes) != 10 {
+		t.Fatalf("GenerateRecoveryCodes() = %v, %v", codes, err)
+	}
+
+	seen := map[string]bool{}
+
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || seen[code] {
+			t.Errorf("GenerateRecoveryCodes() code %q", code)
+		}
+		seen[code] = true
+
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", " "))
+
+		if auth.NormalizeRecoveryCode(typed) != code {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", typed, auth.NormalizeRecoveryCode(typed), code)
+		}
+	}
+}
+
+func TestMFATokenIsNotAnAccessToken(t *testing.T) {
+	keys := auth.NewKeySet(auth.NewHMACKey("", "secret"))
+	userID := uuid.New()
+
+	mfaToken, _ := keys.MakeMFAToken(userID, time.Minute)
+
+	if _, err := keys.ParseJWT(mfaToken); err == nil {
+		t.Errorf("ParseJWT() accepted an MFA token")
+	}
+
+	got, err := keys.ParseMFAToken(mfaToken)
+
+	if err != nil || got != userID {
+		t.Errorf("ParseMFAToken() = %v, %v", got, err)
+	}
+
+	accessToken, _ := keys.MakeJWT(auth.AccessToken{UserID: userID, Role: auth.RoleUser}, time.Minute)
+
+	if _, err := keys.ParseMFAToken(accessToken); err == nil {
+		t.Errorf("ParseMFAToken() accepted an access token")
+	}
+}
+
+func TestSecretBox(t *testing.T) {
+	key, err := auth.ParseSecretKey("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+
+	if err != nil {
+		t.Fatalf("ParseSecretKey() error = %v", err)
+	}
+
+	box, _ := auth.NewSecretBox(key)
+	userID := uuid.NewString()
+	sealed, err := box.Seal(rfcSecret, userID)
+
+	if err != nil || !auth.IsSealed(sealed) || strings.Contains(sealed, rfcSecret) {
+		t.Fatalf("Seal() = %q, %v", sealed, err)
+	}
+
+	if secret, err := box.Open(sealed, userID); err != nil || secret != rfcSecret {
+		t.Errorf("Open() = %q, %v", secret, err)
+	}
+
+	// A sealed secret copied to another user doesn't open
+	if _, err := box.Open(sealed, uuid.NewString()); err == nil {
+		t.Errorf("Open() with other associated data expected error")
+	}
+
+	otherKey, _ := auth.ParseSecretKey("ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	otherBox, _ := auth.NewSecretBox(otherKey)
+
+	if _, err := otherBox.Open(sealed, userID); err == nil {
+		t.Errorf("Open() with another key expected error")
+	}
+
+	if _, err := box.Open(rfcSecret, userID); err == nil {
+		t.Errorf("Open() of a plaintext secret expected error")
+	}
+
+	if _, err := auth.ParseSecretKey("c2hvcnQ="); err == nil {
+		t.Errorf("ParseSecretKey() of a short key expected error")
+	}
+}
+
+func TestDisableTOTPIsThrottled(t *testing.T) {
+	policy := auth.ThrottlePolicy{BackoffAfter: 3, LockoutAfter: 5, BaseDelay: time.Second, LockoutDuration: time.Minute}
+	cfg := apiConfig{
+		jwtKeys:         auth.NewKeySet(auth.NewHMACKey("", "secret")),
+		accountThrottle: auth.NewLoginThrottle(policy),
+		ipThrottle:      auth.NewLoginThrottle(auth.ThrottlePolicy{BackoffAfter: 100, LockoutAfter: 100, BaseDelay: time.Second, LockoutDuration: time.Minute}),
+		tokenVersions: auth.NewTokenVersionCache(time.Minute, func(ctx context.Context, userID uuid.UUID) (int32, error) {
+			return 0, nil
+		}),
+	}
+	userID := uuid.New()
+	accessToken, _ := cfg.jwtKeys.MakeJWT(auth.AccessToken{UserID: userID, Role: auth.RoleUser}, time.Minute)
+
+	// Wrong codes are counted against the same key as MFA logins
+	for range policy.LockoutAfter {
+		cfg.accountThrottle.Fail("mfa:"+userID.String(), time.Now())
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/mfa/totp/disable", strings.NewReader(`{"password": "guess", "code": "123456"}`))
+	r.RemoteAddr = "203.0.113.5:4000"
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+
+	// Refused before the database is used, cfg has none
+	cfg.handleDisableTOTP(w, r)
+
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("handleDisableTOTP() after %d wrong codes = %d %v", policy.LockoutAfter, w.Code, w.Header())
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/google/uuid"
+)
+
+// authenticate validates the access token of the request
+func (cfg *apiConfig) authenticate(r *http.Request) (uuid.UUID, *auth.Claims, error) {
+	accessToken, err := auth.GetBearerToken(r.Header)
+
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	claims, err := cfg.jwtKeys.ParseJWT(accessToken)
+
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+
+	if err != nil {
+		return uuid.Nil, nil, errors.New("invalid user ID")
+	}
+
+	// Tokens issued before the user's last password change or sign out
+	// everywhere carry an older version
+	version, err := cfg.tokenVersions.Get(r.Context(), userID)
+
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	if claims.Version < version {
+		return uuid.Nil, nil, errors.New("access token has been revoked")
+	}
+
+	return userID, claims, nil
+}
+
+// middlewareRequireRole only lets requests through when the access token
+// carries one of roles
+func (cfg *apiConfig) middlewareRequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, claims, err := cfg.authenticate(r)
+
+			if err != nil {
+				respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+				return
+			}
+
+			if !slices.Contains(roles, claims.Role) {
+				respondWithError(w, http.StatusForbidden, "ERROR Forbidden You don't have an access", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/FallenL3vi/WebServer/internal/moderation"
+	"github.com/google/uuid"
+)
+
+// Values of moderation_queue.source and moderation_queue.status
+const (
+	moderationSourceFilter = "filter"
+	moderationSourceReport = "report"
+
+	moderationPending  = "pending"
+	moderationApproved = "approved"
+	moderationRemoved  = "removed"
+)
+
+const maxReportReasonLength = 500
+
+// validateChirp applies the rules every chirp body has to pass before
+// it is stored, maxLength comes from the plan of the author. The returned
+// Text is what should be saved.
+func (cfg *apiConfig) validateChirp(body string, maxLength int) (moderation.Result, error) {
+	if utf8.RuneCountInString(body) > maxLength {
+		return moderation.Result{}, fmt.Errorf("Is too long, the limit is %d characters", maxLength)
+	}
+
+	result := cfg.filter.Check(body)
+
+	if result.Rejected {
+		return result, errors.New("Chirp contains words that aren't allowed")
+	}
+
+	return result, nil
+}
+
+// bannedWordsSource loads the word list from the banned_words table
+func bannedWordsSource(queries *database.Queries) moderation.Source {
+	return moderation.SourceFunc(func(ctx context.Context) ([]moderation.Rule, error) {
+		words, err := queries.ListBannedWords(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rules := []moderation.Rule{}
+
+		for _, word := range words {
+			action, err := moderation.ParseAction(word.Action)
+
+			if err != nil {
+				return nil, err
+			}
+
+			rules = append(rules, moderation.Rule{
+				Word:        word.Word,
+				Action:      action,
+				Replacement: word.Replacement.String,
+			})
+		}
+
+		return rules, nil
+	})
+}
+
+// flagForReview puts a post the filter flagged into the moderation queue.
+// It is hidden from the start and stays hidden until an admin approves it.
+func flagForReview(ctx context.Context, queries *database.Queries, postID uuid.UUID, moderated moderation.Result) error {
+	words := []string{}
+
+	for _, match := range moderated.Matches {
+		if match.Action == moderation.ActionFlag {
+			words = append(words, match.Word)
+		}
+	}
+
+	_, err := queries.EnqueuePost(ctx, database.EnqueuePostParams{
+		PostID: postID,
+		Source: moderationSourceFilter,
+		Reason: "flagged words: " + strings.Join(words, ", "),
+		Hidden: true,
+	})
+
+	return err
+}
+
+func (cfg *apiConfig) handleReportPost(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason string `json:"reason"`
+	}
+
+	userID, _, err := cfg.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+		return
+	}
+
+	postUUID, err := uuid.Parse(r.PathValue("chirpID"))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR  couldn't parse string", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters:", err)
+		return
+	}
+
+	params.Reason = strings.TrimSpace(params.Reason)
+
+	if params.Reason == "" || len(params.Reason) > maxReportReasonLength {
+		respondWithError(w, http.StatusBadRequest, "ERROR a reason of at most 500 characters is required", nil)
+		return
+	}
+
+	_, err = cfg.dbQueries.GetPost(r.Context(), postUUID)
+
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "ERROR  couldn't find the post", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	// A single report only queues the chirp, it is hidden once
+	// reportsToHide different users reported it
+	item, err := queries.EnqueuePost(r.Context(), database.EnqueuePostParams{
+		PostID:     postUUID,
+		Source:     moderationSourceReport,
+		Reason:     params.Reason,
+		ReporterID: uuid.NullUUID{UUID: userID, Valid: true},
+	})
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't report the post", err)
+		return
+	}
+
+	added, err := queries.AddModerationReport(r.Context(), database.AddModerationReportParams{
+		ItemID:     item.ID,
+		ReporterID: userID,
+		Reason:     params.Reason,
+	})
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't report the post", err)
+		return
+	}
+
+	// Reporting the same chirp again doesn't count twice
+	if added > 0 {
+		err = queries.CountModerationReport(r.Context(), database.CountModerationReportParams{
+			HideAfter: int32(cfg.reportsToHide),
+			ID:        item.ID,
+		})
+
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "ERROR couldn't report the post", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't report the post", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/FallenL3vi/WebServer/internal/moderation"
+)
+
+func staticWords(rules ...moderation.Rule) moderation.Source {
+	return moderation.SourceFunc(func(ctx context.Context) ([]moderation.Rule, error) {
+		return rules, nil
+	})
+}
+
+func TestWordFilterCheck(t *testing.T) {
+	filter, err := moderation.NewWordFilter(context.Background(), staticWords(
+		moderation.Rule{Word: "kerfuffle"},
+		moderation.Rule{Word: "sharbert", Action: moderation.ActionReplace, Replacement: "[removed]"},
+		moderation.Rule{Word: "fornax", Action: moderation.ActionReject},
+		moderation.Rule{Word: "bolt", Action: moderation.ActionFlag},
+	))
+
+	if err != nil {
+		t.Fatalf("NewWordFilter() error = %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		text         string
+		wantText     string
+		wantRejected bool
+		wantFlagged  bool
+	}{
+		{"Clean", "I had a lovely day", "I had a lovely day", false, false},
+		{"Punctuation", "What a Kerfuffle!", "What a ****!", false, false},
+		{"Case folding", "KERFUFFLE kerFuffle", "**** ****", false, false},
+		{"Leetspeak", "k3rfuff13 and $h@rbert", "**** and [removed]", false, false},
+		{"Substring is fine", "kerfuffles", "kerfuffles", false, false},
+		{"Reject", "fornax.", "fornax.", true, false},
+		{"Leading symbol", "@kerfuffle", "@****", false, false},
+		{"Trailing symbol", "kerfuffle$", "****$", false, false},
+		{"Reject with trailing symbol", "fornax@", "fornax@", true, false},
+		{"Flag", "b0lt", "b0lt", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filter.Check(tt.text)
+			if got.Text != tt.wantText || got.Rejected != tt.wantRejected || got.Flagged != tt.wantFlagged {
+				t.Errorf("Check(%q) = %+v, want text %q rejected %v flagged %v", tt.text, got, tt.wantText, tt.wantRejected, tt.wantFlagged)
+			}
+		})
+	}
+}
+
+func TestWordFilterReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	os.WriteFile(path, []byte("# comment\nkerfuffle\n"), 0o600)
+
+	filter, err := moderation.NewWordFilter(context.Background(), moderation.FileSource{Path: path})
+
+	if err != nil {
+		t.Fatalf("NewWordFilter() error = %v", err)
+	}
+
+	if got := filter.Check("fornax").Text; got != "fornax" {
+		t.Errorf("Check() before reload = %q", got)
+	}
+
+	os.WriteFile(path, []byte("kerfuffle\nfornax reject\n"), 0o600)
+
+	if err := filter.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	if !filter.Check("fornax").Rejected {
+		t.Errorf("Check() after reload didn't reject")
+	}
+}
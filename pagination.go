@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// Sort keys of GET /api/chirps, each has its own ListPostsBy query
+const (
+	sortKeyCreatedAt = "created_at"
+	sortKeyUpdatedAt = "updated_at"
+	sortKeyLength    = "length"
+)
+
+type postSort struct {
+	Key        string
+	Descending bool
+}
+
+// parsePostSort validates the sort_by and sort query parameters.
+// Both are optional and default to created_at ascending.
+func parsePostSort(sortBy, order string) (postSort, error) {
+	result := postSort{Key: sortKeyCreatedAt}
+
+	switch sortBy {
+	case "", sortKeyCreatedAt:
+	case sortKeyUpdatedAt, sortKeyLength:
+		result.Key = sortBy
+	default:
+		return postSort{}, fmt.Errorf("sort_by must be one of %s, %s, %s", sortKeyCreatedAt, sortKeyUpdatedAt, sortKeyLength)
+	}
+
+	switch order {
+	case "", "asc":
+	case "desc":
+		result.Descending = true
+	default:
+		return postSort{}, errors.New("sort must be asc or desc")
+	}
+
+	return result, nil
+}
+
+// postCursor is the position of the last chirp on a page. Clients only ever
+// see it base64 encoded so the format can change without breaking them.
+// Only the field matching SortKey is set.
+type postCursor struct {
+	SortKey string
+	Time    time.Time
+	Length  int32
+	ID      uuid.UUID
+}
+
+func cursorForPost(post Post, sortKey string) postCursor {
+	cursor := postCursor{SortKey: sortKey, ID: post.ID}
+
+	switch sortKey {
+	case sortKeyUpdatedAt:
+		cursor.Time = post.UpdatedAt
+	case sortKeyLength:
+		cursor.Length = int32(utf8.RuneCountInString(post.Body))
+	default:
+		cursor.Time = post.CreatedAt
+	}
+
+	return cursor
+}
+
+func encodeCursor(cursor postCursor) string {
+	var value string
+
+	if cursor.SortKey == sortKeyLength {
+		value = strconv.Itoa(int(cursor.Length))
+	} else {
+		value = cursor.Time.UTC().Format(time.RFC3339Nano)
+	}
+
+	raw := cursor.SortKey + "|" + value + "|" + cursor.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (postCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return postCursor{}, errors.New("malformed cursor")
+	}
+
+	parts := strings.Split(string(raw), "|")
+
+	if len(parts) != 3 {
+		return postCursor{}, errors.New("malformed cursor")
+	}
+
+	cursor := postCursor{SortKey: parts[0]}
+
+	switch cursor.SortKey {
+	case sortKeyCreatedAt, sortKeyUpdatedAt:
+		cursor.Time, err = time.Parse(time.RFC3339Nano, parts[1])
+	case sortKeyLength:
+		var length int64
+		length, err = strconv.ParseInt(parts[1], 10, 32)
+		cursor.Length = int32(length)
+	default:
+		err = errors.New("unknown sort key")
+	}
+
+	if err != nil {
+		return postCursor{}, errors.New("malformed cursor")
+	}
+
+	cursor.ID, err = uuid.Parse(parts[2])
+
+	if err != nil {
+		return postCursor{}, errors.New("malformed cursor")
+	}
+
+	return cursor, nil
+}
+
+// postPage selects one page of GET /api/chirps
+type postPage struct {
+	Sort     postSort
+	AuthorID uuid.NullUUID
+	// Cursor is nil on the first page
+	Cursor *postCursor
+	Limit  int32
+}
+
+// listPosts runs the query of the sort key and direction. Each one orders
+// by a plain (column, id) so Postgres can walk the matching index instead
+// of sorting every chirp.
+func listPosts(ctx context.Context, queries *database.Queries, page postPage) ([]Post, error) {
+	cursorID := uuid.NullUUID{}
+	cursorTime := sql.NullTime{}
+	cursorLength := sql.NullInt32{}
+
+	if page.Cursor != nil {
+		cursorID = uuid.NullUUID{UUID: page.Cursor.ID, Valid: true}
+		cursorTime = sql.NullTime{Time: page.Cursor.Time, Valid: true}
+		cursorLength = sql.NullInt32{Int32: page.Cursor.Length, Valid: true}
+	}
+
+	switch page.Sort {
+	case postSort{Key: sortKeyUpdatedAt}:
+		return postsFromRows(queries.ListPostsByUpdatedAtAsc(ctx, database.ListPostsByUpdatedAtAscParams{
+			AuthorID:   page.AuthorID,
+			CursorID:   cursorID,
+			CursorTime: cursorTime,
+			PageLimit:  page.Limit,
+		}))
+	case postSort{Key: sortKeyUpdatedAt, Descending: true}:
+		return postsFromRows(queries.ListPostsByUpdatedAtDesc(ctx, database.ListPostsByUpdatedAtDescParams{
+			AuthorID:   page.AuthorID,
+			CursorID:   cursorID,
+			CursorTime: cursorTime,
+			PageLimit:  page.Limit,
+		}))
+	case postSort{Key: sortKeyLength}:
+		return postsFromRows(queries.ListPostsByLengthAsc(ctx, database.ListPostsByLengthAscParams{
+			AuthorID:     page.AuthorID,
+			CursorID:     cursorID,
+			CursorLength: cursorLength,
+			PageLimit:    page.Limit,
+		}))
+	case postSort{Key: sortKeyLength, Descending: true}:
+		return postsFromRows(queries.ListPostsByLengthDesc(ctx, database.ListPostsByLengthDescParams{
+			AuthorID:     page.AuthorID,
+			CursorID:     cursorID,
+			CursorLength: cursorLength,
+			PageLimit:    page.Limit,
+		}))
+	case postSort{Key: sortKeyCreatedAt, Descending: true}:
+		return postsFromRows(queries.ListPostsByCreatedAtDesc(ctx, database.ListPostsByCreatedAtDescParams{
+			AuthorID:   page.AuthorID,
+			CursorID:   cursorID,
+			CursorTime: cursorTime,
+			PageLimit:  page.Limit,
+		}))
+	default:
+		return postsFromRows(queries.ListPostsByCreatedAtAsc(ctx, database.ListPostsByCreatedAtAscParams{
+			AuthorID:   page.AuthorID,
+			CursorID:   cursorID,
+			CursorTime: cursorTime,
+			PageLimit:  page.Limit,
+		}))
+	}
+}
+
+// postRow is the shape every ListPostsBy query returns, so each row type
+// converts to Post
+type postRow interface {
+	~struct {
+		ID        uuid.UUID
+		CreatedAt time.Time
+		UpdatedAt time.Time
+		Body      string
+		UserID    uuid.UUID
+	}
+}
+
+func postsFromRows[T postRow](rows []T, err error) ([]Post, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]Post, 0, len(rows))
+
+	for _, row := range rows {
+		posts = append(posts, Post(row))
+	}
+
+	return posts, nil
+}
+
+func parsePageLimit(s string) (int, error) {
+	if s == "" {
+		return defaultPageLimit, nil
+	}
+
+	limit, err := strconv.Atoi(s)
+
+	if err != nil || limit < 1 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	return limit, nil
+}
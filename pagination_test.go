@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []postCursor{
+		{SortKey: sortKeyCreatedAt, Time: time.Date(2025, 4, 1, 12, 30, 0, 123456000, time.UTC), ID: uuid.New()},
+		{SortKey: sortKeyUpdatedAt, Time: time.Date(2025, 4, 2, 8, 0, 0, 0, time.UTC), ID: uuid.New()},
+		{SortKey: sortKeyLength, Length: 42, ID: uuid.New()},
+	}
+
+	for _, want := range tests {
+		got, err := decodeCursor(encodeCursor(want))
+
+		if err != nil {
+			t.Fatalf("decodeCursor() error = %v", err)
+		}
+		if got.SortKey != want.SortKey || !got.Time.Equal(want.Time) || got.Length != want.Length || got.ID != want.ID {
+			t.Errorf("decodeCursor() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm8tc2VwYXJhdG9y", encodeCursor(postCursor{SortKey: sortKeyLength})[:10]} {
+		if _, err := decodeCursor(cursor); err == nil {
+			t.Errorf("decodeCursor(%q) expected error", cursor)
+		}
+	}
+}
+
+func TestParsePostSort(t *testing.T) {
+	tests := []struct {
+		sortBy  string
+		order   string
+		want    postSort
+		wantErr bool
+	}{
+		{"", "", postSort{Key: sortKeyCreatedAt}, false},
+		{"", "desc", postSort{Key: sortKeyCreatedAt, Descending: true}, false},
+		{"updated_at", "asc", postSort{Key: sortKeyUpdatedAt}, false},
+		{"length", "desc", postSort{Key: sortKeyLength, Descending: true}, false},
+		{"likes", "", postSort{}, true},
+		{"", "newest", postSort{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePostSort(tt.sortBy, tt.order)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePostSort(%q, %q) error = %v, wantErr %v", tt.sortBy, tt.order, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parsePostSort(%q, %q) = %v, want %v", tt.sortBy, tt.order, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/FallenL3vi/WebServer/internal/mailer"
+)
+
+// Reset emails are sent by a few workers from a bounded queue, so a flood
+// of requests can't start unlimited goroutines
+const (
+	passwordResetQueueSize   = 100
+	passwordResetWorkers     = 2
+	passwordResetSendTimeout = 30 * time.Second
+)
+
+// checkPassword responds with 400 and every rule the password breaks when
+// it doesn't meet the password policy
+func (cfg *apiConfig) checkPassword(w http.ResponseWriter, password string) bool {
+	type response struct {
+		Error      string   `json:"error"`
+		Violations []string `json:"violations"`
+	}
+
+	err := cfg.passwordPolicy.Check(password)
+
+	if err == nil {
+		return true
+	}
+
+	weak := &auth.WeakPasswordError{}
+
+	if !errors.As(err, &weak) {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't check the password", err)
+		return false
+	}
+
+	respondWithJSON(w, http.StatusBadRequest, response{
+		Error:      "ERROR password doesn't meet the requirements",
+		Violations: weak.Violations,
+	})
+	return false
+}
+
+// rehashPassword replaces the stored hash with one made with the current
+// algorithm and parameters. Failing only delays the upgrade to the next
+// login, so errors are logged instead of failing the login.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, user database.User, password string) {
+	hash, err := cfg.passwordHasher.Hash(password)
+
+	if err != nil {
+		log.Printf("Error rehashing password of user %s: %s", user.ID, err)
+		return
+	}
+
+	// The old hash guards against overwriting a password changed meanwhile
+	err = cfg.dbQueries.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: hash,
+		ID:      user.ID,
+		OldHash: user.HashedPassword,
+	})
+
+	if err != nil {
+		log.Printf("Error rehashing password of user %s: %s", user.ID, err)
+	}
+}
+
+func (cfg *apiConfig) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters:", err)
+		return
+	}
+
+	// The answer and its timing are the same whether the account exists or
+	// not, so the lookup and the email happen after responding
+	select {
+	case cfg.passwordResets <- params.Email:
+	default:
+		log.Printf("Password reset queue is full, dropping a request")
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// startPasswordResetWorkers sends the emails queued by handleForgotPassword.
+// When ctx is cancelled the workers send what is still queued and stop,
+// main waits for them through cfg.background.
+func (cfg *apiConfig) startPasswordResetWorkers(ctx context.Context) {
+	cfg.passwordResets = make(chan string, passwordResetQueueSize)
+
+	for range passwordResetWorkers {
+		cfg.background.Add(1)
+
+		go func() {
+			defer cfg.background.Done()
+
+			for {
+				select {
+				case email := <-cfg.passwordResets:
+					cfg.sendQueuedPasswordReset(email)
+				case <-ctx.Done():
+					cfg.drainPasswordResets()
+					return
+				}
+			}
+		}()
+	}
+}
+
+// drainPasswordResets sends the emails left in the queue without waiting
+// for new ones
+func (cfg *apiConfig) drainPasswordResets() {
+	for {
+		select {
+		case email := <-cfg.passwordResets:
+			cfg.sendQueuedPasswordReset(email)
+		default:
+			return
+		}
+	}
+}
+
+func (cfg *apiConfig) sendQueuedPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), passwordResetSendTimeout)
+	defer cancel()
+
+	cfg.sendPasswordReset(ctx, email)
+}
+
+// sendPasswordReset mails a reset link to the account of email, if there is
+// one. Earlier links of the account stop working.
+func (cfg *apiConfig) sendPasswordReset(ctx context.Context, email string) {
+	user, err := cfg.dbQueries.GetUserByEmail(ctx, email)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error looking up user for password reset: %s", err)
+		return
+	}
+
+	token, err := auth.MakeToken()
+
+	if err != nil {
+		log.Printf("Error making password reset token: %s", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		log.Printf("Error starting transaction: %s", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	err = queries.DeletePasswordResetTokens(ctx, user.ID)
+
+	if err != nil {
+		log.Printf("Error deleting password reset tokens of user %s: %s", user.ID, err)
+		return
+	}
+
+	err = queries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().UTC().Add(cfg.passwordResetTTL),
+	})
+
+	if err != nil {
+		log.Printf("Error saving password reset token of user %s: %s", user.ID, err)
+		return
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		log.Printf("Error saving password reset token of user %s: %s", user.ID, err)
+		return
+	}
+
+	link, err := passwordResetLink(cfg.passwordResetURL, token)
+
+	if err != nil {
+		log.Printf("Error making password reset link: %s", err)
+		return
+	}
+
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: "Somebody asked to reset the password of your Chirpy account. Open this link to choose a new one:\n\n" +
+			link + "\n\n" +
+			"The link works once and expires in " + cfg.passwordResetTTL.String() + ".\n" +
+			"If it wasn't you, ignore this email, your password stays the same.\n",
+	})
+
+	if err != nil {
+		log.Printf("Error sending password reset email to user %s: %s", user.ID, err)
+	}
+}
+
+// passwordResetLink adds token to the reset page, which may already have a
+// query of its own
+func passwordResetLink(page, token string) (string, error) {
+	u, err := url.Parse(page)
+
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func (cfg *apiConfig) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters:", err)
+		return
+	}
+
+	if params.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "ERROR missing reset token", nil)
+		return
+	}
+
+	if !cfg.checkPassword(w, params.Password) {
+		return
+	}
+
+	hashedPassword, err := cfg.passwordHasher.Hash(params.Password)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't hash the password", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	userID, err := queries.ConsumePasswordResetToken(r.Context(), auth.HashToken(params.Token))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "ERROR reset link is invalid or expired", err)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't reset the password", err)
+		return
+	}
+
+	version, err := queries.ResetUserPassword(r.Context(), database.ResetUserPasswordParams{
+		HashedPassword: hashedPassword,
+		ID:             userID,
+	})
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't reset the password", err)
+		return
+	}
+
+	// Whoever got in with the old password is signed out everywhere
+	err = queries.RevokeAllUserSessions(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR COULDN'T REVOKE SESSIONS", err)
+		return
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't reset the password", err)
+		return
+	}
+
+	cfg.tokenVersions.Set(userID, version)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := auth.PasswordPolicy{MinLength: 8, MaxBytes: 72, MinClasses: 3}
+
+	tests := []struct {
+		password   string
+		violations int
+	}{
+		{"Chirpy-2025", 0},
+		{"", 2},
+		{"short1A", 1},
+		{"alllowercase", 1},
+		{"Aa1" + strings.Repeat("x", 70), 1},
+		// 8 characters but 24 bytes
+		{"éééééé1A", 0},
+	}
+
+	for _, tt := range tests {
+		err := policy.Check(tt.password)
+		weak := &auth.WeakPasswordError{}
+
+		if tt.violations == 0 {
+			if err != nil {
+				t.Errorf("Check(%q) error = %v", tt.password, err)
+			}
+			continue
+		}
+
+		if !errors.As(err, &weak) || len(weak.Violations) != tt.violations {
+			t.Errorf("Check(%q) error = %v, want %d violations", tt.password, err, tt.violations)
+		}
+	}
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	sum := sha1.Sum([]byte("password123"))
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	os.WriteFile(path, []byte("# top passwords\n"+strings.ToUpper(hex.EncodeToString(sum[:]))+":123456\n\n"), 0o600)
+
+	breached, err := auth.LoadBreachedPasswords(path)
+
+	if err != nil {
+		t.Fatalf("LoadBreachedPasswords() error = %v", err)
+	}
+
+	policy := auth.DefaultPasswordPolicy()
+	policy.Breached = breached
+
+	if err := policy.Check("password123"); err == nil || !strings.Contains(err.Error(), "breached") {
+		t.Errorf("Check() error = %v, want breached", err)
+	}
+
+	if err := policy.Check("password124"); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+
+	os.WriteFile(path, []byte("not-a-hash\n"), 0o600)
+
+	if _, err := auth.LoadBreachedPasswords(path); err == nil {
+		t.Errorf("LoadBreachedPasswords() expected error")
+	}
+}
+
+func TestPasswordHasher(t *testing.T) {
+	params := auth.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hasher := &auth.PasswordHasher{Params: params}
+
+	hash, err := hasher.Hash("Chirpy-2025")
+
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("Hash() = %q, want a PHC argon2id string", hash)
+	}
+
+	if err := hasher.Check(hash, "Chirpy-2025"); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+
+	if err := hasher.Check(hash, "chirpy-2025"); err == nil {
+		t.Errorf("Check() accepted a wrong password")
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Errorf("NeedsRehash() = true for current parameters")
+	}
+
+	stronger := &auth.PasswordHasher{Params: params}
+	stronger.Params.Iterations = 2
+
+	if !stronger.NeedsRehash(hash) {
+		t.Errorf("NeedsRehash() = false after raising the iterations")
+	}
+
+	// Hashes made with other parameters still verify
+	if err := stronger.Check(hash, "Chirpy-2025"); err != nil {
+		t.Errorf("Check() with other parameters error = %v", err)
+	}
+}
+
+func TestPasswordHasherBcrypt(t *testing.T) {
+	hasher := &auth.PasswordHasher{Params: auth.DefaultArgon2Params()}
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("Chirpy-2025"), bcrypt.MinCost)
+
+	if err := hasher.Check(string(legacy), "Chirpy-2025"); err != nil {
+		t.Errorf("Check() bcrypt error = %v", err)
+	}
+
+	if !hasher.NeedsRehash(string(legacy)) {
+		t.Errorf("NeedsRehash() = false for a bcrypt hash")
+	}
+
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5"} {
+		if err := hasher.Check(hash, "Chirpy-2025"); err == nil {
+			t.Errorf("Check(%q) expected error", hash)
+		}
+	}
+}
+
+func TestPasswordResetLink(t *testing.T) {
+	tests := []struct {
+		page string
+		want string
+	}{
+		{"http://localhost:8080/app/reset-password/", "http://localhost:8080/app/reset-password/?token=a%2Bb"},
+		{"https://chirpy.example/reset?lang=en", "https://chirpy.example/reset?lang=en&token=a%2Bb"},
+	}
+
+	for _, tt := range tests {
+		got, err := passwordResetLink(tt.page, "a+b")
+
+		if err != nil || got != tt.want {
+			t.Errorf("passwordResetLink(%q) = %q, %v, want %q", tt.page, got, err, tt.want)
+		}
+	}
+}
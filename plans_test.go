@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FallenL3vi/WebServer/internal/config"
+	"github.com/FallenL3vi/WebServer/internal/moderation"
+	"github.com/FallenL3vi/WebServer/internal/plans"
+)
+
+func TestPlanEntitlements(t *testing.T) {
+	filter, err := moderation.NewWordFilter(context.Background(), staticWords())
+
+	if err != nil {
+		t.Fatalf("NewWordFilter() error = %v", err)
+	}
+
+	cfg := apiConfig{filter: filter, plans: plans.DefaultTable()}
+	free := cfg.plans.For(false)
+	red := cfg.plans.For(true)
+
+	if free.Name != "free" || red.Name != "red" {
+		t.Fatalf("For() = %q, %q", free.Name, red.Name)
+	}
+
+	if free.CanEditChirps || !red.CanEditChirps {
+		t.Errorf("only red may edit chirps")
+	}
+
+	if free.PostRate.Requests >= red.PostRate.Requests {
+		t.Errorf("free post rate %v isn't below red %v", free.PostRate, red.PostRate)
+	}
+
+	body := strings.Repeat("a", 200)
+
+	if _, err := cfg.validateChirp(body, free.MaxChirpLength); err == nil {
+		t.Errorf("validateChirp() allowed %d characters on the free plan", len(body))
+	}
+
+	if _, err := cfg.validateChirp(body, red.MaxChirpLength); err != nil {
+		t.Errorf("validateChirp() on the red plan error = %v", err)
+	}
+
+	// The limit counts characters, not bytes
+	accented := strings.Repeat("é", free.MaxChirpLength)
+
+	if _, err := cfg.validateChirp(accented, free.MaxChirpLength); err != nil {
+		t.Errorf("validateChirp() of %d two byte characters error = %v", free.MaxChirpLength, err)
+	}
+}
+
+func TestConfigPlans(t *testing.T) {
+	t.Setenv("DB_URL", "postgres://localhost/chirpy")
+	t.Setenv("SECRET_JWT", "0123456789abcdef0123456789abcdef")
+	t.Setenv("POLKA_KEY", "key")
+	t.Setenv("TOTP_ENCRYPTION_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	t.Setenv("PLATFORM", "dev")
+	t.Setenv("PLAN_FREE_CAN_EDIT", "true")
+	t.Setenv("PLAN_RED_MAX_CHIRP_LENGTH", "1000")
+	t.Setenv("PLAN_RED_POST_RATE", "5/1s")
+
+	conf, _, err := config.Load([]string{"-env-file", filepath.Join(t.TempDir(), "missing")})
+
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// Settings that aren't overridden keep their defaults
+	if !conf.Plans.Free.CanEditChirps || conf.Plans.Free.MaxChirpLength != 140 || conf.Plans.Red.MaxChirpLength != 1000 || conf.Plans.Red.PostRate.String() != "5/1s" {
+		t.Errorf("Plans = %+v", conf.Plans)
+	}
+
+	// Without a configured one the route limit of posting lets the widest
+	// plan through: the burst of free at the rate of red
+	if got := conf.RateLimits["POST /api/chirps"].String(); got != "10/2s" {
+		t.Errorf("POST /api/chirps limit = %s, want 10/2s", got)
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/google/uuid"
+)
+
+// Polka webhook events, others are acknowledged and ignored
+const (
+	polkaUserUpgraded          = "user.upgraded"
+	polkaUserDowngraded        = "user.downgraded"
+	polkaSubscriptionRenewed   = "subscription.renewed"
+	polkaSubscriptionCancelled = "subscription.cancelled"
+)
+
+// Values of subscriptions.status
+const (
+	subscriptionActive    = "active"
+	subscriptionCancelled = "cancelled"
+	subscriptionExpired   = "expired"
+)
+
+var (
+	errPolkaUserNotFound = errors.New("user not found")
+	errInvalidPolkaEvent = errors.New("invalid event")
+	errStalePolkaEvent   = errors.New("older than the last event applied to the subscription")
+)
+
+// Values of webhook_events.status
+const (
+	webhookPending   = "pending"
+	webhookProcessed = "processed"
+	webhookIgnored   = "ignored"
+	webhookFailed    = "failed"
+)
+
+const maxWebhookBytes = 64 << 10
+
+// webhookClaimTimeout is how long an event may stay pending before it
+// counts as abandoned, e.g. by a server that died while processing it, and
+// a retry or replay may claim it again
+const webhookClaimTimeout = 5 * time.Minute
+
+type polkaEvent struct {
+	// ID is the same on every retry of a delivery
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	// CreatedAt is when the event happened at Polka
+	CreatedAt *time.Time `json:"created_at"`
+	Data      struct {
+		UserID uuid.UUID `json:"user_id"`
+		// ExpiresAt is the end of the paid period
+		ExpiresAt *time.Time `json:"expires_at"`
+	} `json:"data"`
+}
+
+// subscriptionChange is the state a Polka event leaves the subscription and
+// the user in
+type subscriptionChange struct {
+	Status    string
+	PeriodEnd sql.NullTime
+	ChirpyRed bool
+}
+
+// nextSubscription works out what event does to a user who is isChirpyRed
+// now and whose current period ends at periodEnd
+func nextSubscription(event polkaEvent, isChirpyRed bool, periodEnd sql.NullTime, now time.Time) (subscriptionChange, error) {
+	expiresAt := sql.NullTime{}
+
+	if event.Data.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: event.Data.ExpiresAt.UTC(), Valid: true}
+	}
+
+	change := subscriptionChange{}
+
+	switch event.Event {
+	case polkaUserUpgraded:
+		change = subscriptionChange{Status: subscriptionActive, PeriodEnd: expiresAt, ChirpyRed: true}
+	case polkaSubscriptionRenewed:
+		if !expiresAt.Valid {
+			return subscriptionChange{}, fmt.Errorf("%w: %s needs data.expires_at", errInvalidPolkaEvent, event.Event)
+		}
+		change = subscriptionChange{Status: subscriptionActive, PeriodEnd: expiresAt, ChirpyRed: true}
+	case polkaSubscriptionCancelled:
+		// The user keeps what they paid for until the period ends, without
+		// a known end that is now
+		if expiresAt.Valid {
+			periodEnd = expiresAt
+		} else if !periodEnd.Valid {
+			periodEnd = sql.NullTime{Time: now, Valid: true}
+		}
+		change = subscriptionChange{Status: subscriptionCancelled, PeriodEnd: periodEnd, ChirpyRed: isChirpyRed}
+	case polkaUserDowngraded:
+		change = subscriptionChange{PeriodEnd: sql.NullTime{Time: now, Valid: true}}
+	default:
+		return subscriptionChange{}, fmt.Errorf("%w: unknown event %q", errInvalidPolkaEvent, event.Event)
+	}
+
+	// Events can arrive late, a period that is already over ends right away
+	if change.PeriodEnd.Valid && !change.PeriodEnd.Time.After(now) {
+		change.Status = subscriptionExpired
+		change.ChirpyRed = false
+	}
+
+	return change, nil
+}
+
+func knownPolkaEvent(event string) bool {
+	switch event {
+	case polkaUserUpgraded, polkaUserDowngraded, polkaSubscriptionRenewed, polkaSubscriptionCancelled:
+		return true
+	}
+
+	return false
+}
+
+// polkaEventID is what deduplicates deliveries, only an ID sent by Polka.
+// Two deliveries without one may be separate events with the same payload,
+// so each of them is processed.
+func polkaEventID(event polkaEvent) sql.NullString {
+	return sql.NullString{String: event.ID, Valid: event.ID != ""}
+}
+
+// polkaEventTime is when event happened, for ordering events of the same
+// subscription. Events without a time count from when the delivery was
+// first received, a retry or replay keeps that time.
+func polkaEventTime(event polkaEvent, receivedAt time.Time) time.Time {
+	if event.CreatedAt != nil {
+		return event.CreatedAt.UTC()
+	}
+
+	return receivedAt.UTC()
+}
+
+// applyPolkaEvent updates the subscription and Chirpy Red flag of the user
+// the event is about. Events that happened before the last one applied are
+// rejected with errStalePolkaEvent, so a late retry or a replay can't undo
+// a newer change.
+func applyPolkaEvent(ctx context.Context, queries *database.Queries, event polkaEvent, occurredAt time.Time) error {
+	if !knownPolkaEvent(event.Event) {
+		return nil
+	}
+
+	// Locked so deliveries for the same user are applied one after another,
+	// also before the user has a subscription row
+	user, err := queries.GetUserByIDForUpdate(ctx, event.Data.UserID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return errPolkaUserNotFound
+	}
+
+	if err != nil {
+		return err
+	}
+
+	subscription, err := queries.GetSubscription(ctx, user.ID)
+
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	if subscription.LastEventAt.Valid && occurredAt.Before(subscription.LastEventAt.Time) {
+		return errStalePolkaEvent
+	}
+
+	change, err := nextSubscription(event, user.IsChirpyRed, subscription.CurrentPeriodEnd, time.Now().UTC())
+
+	if err != nil {
+		return err
+	}
+
+	err = queries.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:           user.ID,
+		Status:           change.Status,
+		CurrentPeriodEnd: change.PeriodEnd,
+		LastEventAt:      sql.NullTime{Time: occurredAt, Valid: true},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = queries.UpgradeUser(ctx, database.UpgradeUserParams{
+		IsChirpyRed: change.ChirpyRed,
+		ID:          user.ID,
+	})
+
+	return err
+}
+
+// processPolkaEvent applies a claimed event of the webhook_events table,
+// received first at receivedAt, and records how it went. The event is only
+// marked processed together with its changes, a failure is recorded with
+// its error so it can be replayed.
+func (cfg *apiConfig) processPolkaEvent(ctx context.Context, id uuid.UUID, event polkaEvent, receivedAt time.Time) error {
+	err := cfg.applyAndFinishPolkaEvent(ctx, id, event, polkaEventTime(event, receivedAt))
+
+	if err != nil {
+		// Recorded even when the request was cancelled, otherwise the event
+		// stays pending until the claim times out
+		finishErr := cfg.dbQueries.FinishWebhookEvent(context.WithoutCancel(ctx), database.FinishWebhookEventParams{
+			Status: webhookFailed,
+			Error:  sql.NullString{String: err.Error(), Valid: true},
+			ID:     id,
+		})
+
+		if finishErr != nil {
+			log.Printf("Error recording failed webhook event %s: %s", id, finishErr)
+		}
+	}
+
+	return err
+}
+
+func (cfg *apiConfig) applyAndFinishPolkaEvent(ctx context.Context, id uuid.UUID, event polkaEvent, occurredAt time.Time) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	err = applyPolkaEvent(ctx, queries, event, occurredAt)
+	status := webhookProcessed
+	reason := sql.NullString{}
+
+	switch {
+	case errors.Is(err, errStalePolkaEvent):
+		// Acknowledged, Polka has nothing to retry
+		status = webhookIgnored
+		reason = sql.NullString{String: err.Error(), Valid: true}
+	case err != nil:
+		return err
+	case !knownPolkaEvent(event.Event):
+		status = webhookIgnored
+	}
+
+	err = queries.FinishWebhookEvent(ctx, database.FinishWebhookEventParams{
+		Status: status,
+		Error:  reason,
+		ID:     id,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// respondWithPolkaError answers a delivery that couldn't be applied
+func respondWithPolkaError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errPolkaUserNotFound) {
+		respondWithError(w, http.StatusNotFound, "ERROR  USER WAS NOT FOUND OR UNAUTHORIZED", err)
+		return
+	}
+
+	if errors.Is(err, errInvalidPolkaEvent) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	respondWithError(w, http.StatusInternalServerError, "Error Couldn't update the subscription", err)
+}
+
+func (cfg *apiConfig) handlePolkaWebhook(w http.ResponseWriter, r *http.Request) {
+	polkaKey, err := auth.GetAPIKey(r.Header)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR Couldn't exxtract API KEY", err)
+		return
+	}
+
+	if polkaKey != cfg.polkaKey {
+		respondWithError(w, http.StatusUnauthorized, "ERROR AUTHENTICATION FAILED", nil)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR couldn't read the event", err)
+		return
+	}
+
+	event := polkaEvent{}
+	err = json.Unmarshal(payload, &event)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters:", err)
+		return
+	}
+
+	claim, err := cfg.dbQueries.ClaimWebhookEvent(r.Context(), database.ClaimWebhookEventParams{
+		EventID:             polkaEventID(event),
+		EventType:           event.Event,
+		Payload:             payload,
+		ClaimTimeoutSeconds: webhookClaimTimeout.Seconds(),
+	})
+
+	// Polka retries deliveries, one that was handled before is acknowledged
+	// without applying it twice
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't record the event", err)
+		return
+	}
+
+	err = cfg.processPolkaEvent(r.Context(), claim.ID, event, claim.ReceivedAt)
+
+	if err != nil {
+		respondWithPolkaError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNextSubscription(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	nextMonth := now.AddDate(0, 1, 0)
+	lastWeek := now.AddDate(0, 0, -7)
+	at := func(t time.Time) sql.NullTime { return sql.NullTime{Time: t, Valid: true} }
+
+	tests := []struct {
+		name        string
+		event       string
+		expiresAt   *time.Time
+		isChirpyRed bool
+		periodEnd   sql.NullTime
+		want        subscriptionChange
+	}{
+		{"upgrade without end", polkaUserUpgraded, nil, false, sql.NullTime{}, subscriptionChange{subscriptionActive, sql.NullTime{}, true}},
+		{"upgrade", polkaUserUpgraded, &nextMonth, false, sql.NullTime{}, subscriptionChange{subscriptionActive, at(nextMonth), true}},
+		{"renewal after a lapse", polkaSubscriptionRenewed, &nextMonth, false, at(lastWeek), subscriptionChange{subscriptionActive, at(nextMonth), true}},
+		{"cancel keeps the period", polkaSubscriptionCancelled, nil, true, at(nextMonth), subscriptionChange{subscriptionCancelled, at(nextMonth), true}},
+		{"cancel with end", polkaSubscriptionCancelled, &nextMonth, true, sql.NullTime{}, subscriptionChange{subscriptionCancelled, at(nextMonth), true}},
+		{"cancel without any end", polkaSubscriptionCancelled, nil, true, sql.NullTime{}, subscriptionChange{subscriptionExpired, at(now), false}},
+		{"cancel doesn't upgrade", polkaSubscriptionCancelled, &nextMonth, false, sql.NullTime{}, subscriptionChange{subscriptionCancelled, at(nextMonth), false}},
+		{"downgrade", polkaUserDowngraded, &nextMonth, true, at(nextMonth), subscriptionChange{subscriptionExpired, at(now), false}},
+		{"late renewal", polkaSubscriptionRenewed, &lastWeek, true, at(nextMonth), subscriptionChange{subscriptionExpired, at(lastWeek), false}},
+	}
+
+	for _, tt := range tests {
+		event := polkaEvent{Event: tt.event}
+		event.Data.ExpiresAt = tt.expiresAt
+
+		got, err := nextSubscription(event, tt.isChirpyRed, tt.periodEnd, now)
+
+		if err != nil {
+			t.Errorf("%s: nextSubscription() error = %v", tt.name, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("%s: nextSubscription() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	// Renewals have to say until when
+	_, err := nextSubscription(polkaEvent{Event: polkaSubscriptionRenewed}, true, sql.NullTime{}, now)
+
+	if !errors.Is(err, errInvalidPolkaEvent) {
+		t.Errorf("renewal without expires_at error = %v", err)
+	}
+}
+
+func TestPolkaEventTime(t *testing.T) {
+	receivedAt := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	createdAt := time.Date(2025, 6, 1, 13, 59, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	if got := polkaEventTime(polkaEvent{}, receivedAt); !got.Equal(receivedAt) {
+		t.Errorf("polkaEventTime() without created_at = %v, want %v", got, receivedAt)
+	}
+
+	event := polkaEvent{CreatedAt: &createdAt}
+
+	// A late delivery is ordered by when it happened
+	if got := polkaEventTime(event, receivedAt); !got.Equal(createdAt) || got.Location() != time.UTC || !got.Before(receivedAt) {
+		t.Errorf("polkaEventTime() = %v, want %v in UTC", got, createdAt)
+	}
+}
+
+func TestPolkaEventID(t *testing.T) {
+	if got := polkaEventID(polkaEvent{ID: "evt_123"}); got != (sql.NullString{String: "evt_123", Valid: true}) {
+		t.Errorf("polkaEventID() = %+v, want the ID Polka sent", got)
+	}
+
+	// Without an ID identical deliveries can be separate events, nothing
+	// deduplicates them
+	if got := polkaEventID(polkaEvent{Event: polkaUserUpgraded}); got.Valid {
+		t.Errorf("polkaEventID() without an ID = %+v, want NULL", got)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/FallenL3vi/WebServer/internal/ratelimit"
+)
+
+// clientIP is the address the request came from, without the port. Behind
+// a trusted proxy it's taken from X-Forwarded-For: hops are read from the
+// right, the first one that isn't a trusted proxy is the client. Anything
+// left of it could have been sent by the client itself.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+
+	if err != nil || !cfg.trustedProxy(addr) {
+		return host
+	}
+
+	hops := []string{}
+
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	client := addr.Unmap().String()
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+
+		if err != nil {
+			break
+		}
+
+		client = hop.Unmap().String()
+
+		if !cfg.trustedProxy(hop) {
+			break
+		}
+	}
+
+	return client
+}
+
+func (cfg *apiConfig) trustedProxy(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	for _, prefix := range cfg.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rateLimitFor returns the limit of a route pattern of the mux
+func (cfg *apiConfig) rateLimitFor(pattern string) ratelimit.Limit {
+	if limit, ok := cfg.rateLimits[pattern]; ok {
+		return limit
+	}
+
+	return cfg.rateLimitDefault
+}
+
+// rateLimitKey identifies the client, by user when the request carries a
+// valid access token and by IP otherwise. The token version isn't checked,
+// that would cost a query on every request.
+func (cfg *apiConfig) rateLimitKey(r *http.Request) string {
+	if token, err := auth.GetBearerToken(r.Header); err == nil {
+		if claims, err := cfg.jwtKeys.ParseJWT(token); err == nil {
+			return "user:" + claims.Subject
+		}
+	}
+
+	return "ip:" + cfg.clientIP(r)
+}
+
+// allowRequest takes a token from the bucket of key and tells the client
+// where it stands with the RateLimit headers of the IETF httpapi draft. Over
+// the limit it answers 429 and returns false.
+func (cfg *apiConfig) allowRequest(w http.ResponseWriter, r *http.Request, key string, limit ratelimit.Limit) bool {
+	result, ok := cfg.takeToken(r, key, limit)
+
+	if !ok {
+		return true
+	}
+
+	setRateLimitHeaders(w, result, limit)
+
+	if !result.Allowed {
+		respondRateLimited(w, result)
+		return false
+	}
+
+	return true
+}
+
+// allowExtraRequest is allowRequest for a limit a handler checks on top of
+// the route limit of middlewareRateLimit. Its headers replace those of the
+// route only when it refuses the request, so a response describes one limit.
+func (cfg *apiConfig) allowExtraRequest(w http.ResponseWriter, r *http.Request, key string, limit ratelimit.Limit) bool {
+	result, ok := cfg.takeToken(r, key, limit)
+
+	if !ok || result.Allowed {
+		return true
+	}
+
+	setRateLimitHeaders(w, result, limit)
+	respondRateLimited(w, result)
+	return false
+}
+
+// takeToken takes a token from the bucket of key. It returns false when the
+// store failed, a broken store mustn't take the API down with it.
+func (cfg *apiConfig) takeToken(r *http.Request, key string, limit ratelimit.Limit) (ratelimit.Result, bool) {
+	result, err := cfg.rateLimiter.Take(r.Context(), key, limit)
+
+	if err != nil {
+		log.Printf("Error checking the rate limit: %s", err)
+		return ratelimit.Result{}, false
+	}
+
+	return result, true
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimit.Result, limit ratelimit.Limit) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, ceilSeconds(limit.Per)))
+}
+
+func respondRateLimited(w http.ResponseWriter, result ratelimit.Result) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+	respondWithError(w, http.StatusTooManyRequests, "ERROR too many requests, slow down", nil)
+}
+
+// middlewareRateLimit limits requests per client and route with a token
+// bucket
+func (cfg *apiConfig) middlewareRateLimit(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+
+		// Unknown routes share one bucket, so probing them is limited too
+		if !cfg.allowRequest(w, r, pattern+"|"+cfg.rateLimitKey(r), cfg.rateLimitFor(pattern)) {
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
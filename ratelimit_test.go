@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/ratelimit"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ratelimit.ParseLimit(" 10/1m ")
+
+	if err != nil || limit != (ratelimit.Limit{Requests: 10, Per: time.Minute}) {
+		t.Errorf("ParseLimit() = %v, %v", limit, err)
+	}
+
+	for _, bad := range []string{"", "10", "0/1m", "x/1m", "10/0s", "10/soon"} {
+		if _, err := ratelimit.ParseLimit(bad); err == nil {
+			t.Errorf("ParseLimit(%q) expected error", bad)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := ratelimit.NewMemoryStore()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store.Now = func() time.Time { return now }
+	limit := ratelimit.Limit{Requests: 3, Per: 3 * time.Second}
+	ctx := context.Background()
+
+	// The full burst is allowed at once
+	for i := range 3 {
+		result, _ := store.Take(ctx, "a", limit)
+
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("Take() #%d = %+v", i+1, result)
+		}
+	}
+
+	result, _ := store.Take(ctx, "a", limit)
+
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Errorf("Take() over the limit = %+v", result)
+	}
+
+	if other, _ := store.Take(ctx, "b", limit); !other.Allowed {
+		t.Errorf("Take() of another key = %+v", other)
+	}
+
+	// One token comes back per second
+	now = now.Add(time.Second)
+
+	if result, _ := store.Take(ctx, "a", limit); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Take() after a second = %+v", result)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	cfg := apiConfig{trustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+	}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "203.0.113.5:4000", "", "203.0.113.5"},
+		{"untrusted peer is ignored", "203.0.113.5:4000", "198.51.100.7", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.2:4000", "198.51.100.7", "198.51.100.7"},
+		{"spoofed hops on the left", "10.0.0.2:4000", "1.2.3.4, 198.51.100.7", "198.51.100.7"},
+		{"chain of proxies", "10.0.0.2:4000", "198.51.100.7, 192.0.2.1, 10.0.0.3", "198.51.100.7"},
+		{"proxy without header", "10.0.0.2:4000", "", "10.0.0.2"},
+		{"garbage hop", "10.0.0.2:4000", "nonsense", "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+
+		if got := cfg.clientIP(r); got != tt.want {
+			t.Errorf("%s: clientIP() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMiddlewareRateLimit(t *testing.T) {
+	cfg := apiConfig{
+		rateLimiter:      ratelimit.NewMemoryStore(),
+		rateLimitDefault: ratelimit.Limit{Requests: 100, Per: time.Minute},
+		rateLimits: map[string]ratelimit.Limit{
+			"POST /api/login": {Requests: 1, Per: time.Minute},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {})
+	handler := cfg.middlewareRateLimit(mux)
+
+	serve := func(method, path, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := serve(http.MethodPost, "/api/login", "203.0.113.5:4000"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Policy") != "1;w=60" {
+		t.Errorf("first login = %d %v", w.Code, w.Header())
+	}
+
+	w := serve(http.MethodPost, "/api/login", "203.0.113.5:4001")
+
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("second login = %d %v", w.Code, w.Header())
+	}
+
+	// Other routes and other clients have their own buckets
+	if w := serve(http.MethodGet, "/api/healthz", "203.0.113.5:4000"); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "100" {
+		t.Errorf("healthz = %d %v", w.Code, w.Header())
+	}
+
+	if w := serve(http.MethodPost, "/api/login", "198.51.100.7:4000"); w.Code != http.StatusOK {
+		t.Errorf("login of another client = %d", w.Code)
+	}
+}
+
+func TestAllowExtraRequest(t *testing.T) {
+	cfg := apiConfig{
+		rateLimiter:      ratelimit.NewMemoryStore(),
+		rateLimitDefault: ratelimit.Limit{Requests: 100, Per: time.Minute},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		if cfg.allowExtraRequest(w, r, "post|user:1", ratelimit.Limit{Requests: 1, Per: time.Minute}) {
+			w.WriteHeader(http.StatusCreated)
+		}
+	})
+	handler := cfg.middlewareRateLimit(mux)
+
+	serve := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// Allowed requests only describe the route limit
+	if w := serve(); w.Code != http.StatusCreated || w.Header().Get("RateLimit-Policy") != "100;w=60" || len(w.Header().Values("RateLimit-Limit")) != 1 {
+		t.Errorf("first post = %d %v", w.Code, w.Header())
+	}
+
+	// The limit that refused the request replaces them
+	if w := serve(); w.Code != http.StatusTooManyRequests || w.Header().Get("RateLimit-Policy") != "1;w=60" || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("second post = %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/google/uuid"
+)
+
+type PostRevision struct {
+	ID        uuid.UUID `json:"id"`
+	ChirpID   uuid.UUID `json:"chirp_id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	RevisedAt time.Time `json:"revised_at"`
+}
+
+func (cfg *apiConfig) handleUpdatePost(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	userID, _, err := cfg.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+		return
+	}
+
+	postUUID, err := uuid.Parse(r.PathValue("chirpID"))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR  couldn't parse string", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Error decoding parameters:", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusUnauthorized, "ERROR user doesn't exist", err)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't get the user", err)
+		return
+	}
+
+	plan := cfg.plans.For(user.IsChirpyRed)
+
+	if !plan.CanEditChirps {
+		respondWithError(w, http.StatusForbidden, "ERROR editing chirps needs Chirpy Red", nil)
+		return
+	}
+
+	moderated, err := cfg.validateChirp(params.Body, plan.MaxChirpLength)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	// Lock the row so concurrent edits can't both save the same revision
+	post, err := queries.GetPostForUpdate(r.Context(), postUUID)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "ERROR  couldn't find the post", err)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't get the post", err)
+		return
+	}
+
+	if post.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "ERROR UNAUTHORIZED ACCESS", nil)
+		return
+	}
+
+	_, err = queries.CreatePostRevision(r.Context(), database.CreatePostRevisionParams{
+		PostID:    post.ID,
+		Body:      post.Body,
+		CreatedAt: post.UpdatedAt,
+	})
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't save the revision", err)
+		return
+	}
+
+	updated, err := queries.UpdatePost(r.Context(), database.UpdatePostParams{
+		Body:   moderated.Text,
+		ID:     post.ID,
+		UserID: userID,
+	})
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't update the post", err)
+		return
+	}
+
+	if moderated.Flagged {
+		err = flagForReview(r.Context(), queries, updated.ID, moderated)
+
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "ERROR Couldn't queue the post for review", err)
+			return
+		}
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't update the post", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Post{
+		ID:        updated.ID,
+		CreatedAt: updated.CreatedAt,
+		UpdatedAt: updated.UpdatedAt,
+		Body:      updated.Body,
+		UserID:    updated.UserID,
+	})
+}
+
+func (cfg *apiConfig) handleGetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	postUUID, err := uuid.Parse(r.PathValue("chirpID"))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR  couldn't parse string", err)
+		return
+	}
+
+	_, err = cfg.dbQueries.GetVisiblePost(r.Context(), postUUID)
+
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "ERROR  couldn't find the post", err)
+		return
+	}
+
+	revisions, err := cfg.dbQueries.GetPostRevisions(r.Context(), postUUID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't get revisions", err)
+		return
+	}
+
+	returnRevisions := []PostRevision{}
+
+	for _, revision := range revisions {
+		returnRevisions = append(returnRevisions, PostRevision{
+			ID:        revision.ID,
+			ChirpID:   revision.PostID,
+			Body:      revision.Body,
+			CreatedAt: revision.CreatedAt,
+			RevisedAt: revision.RevisedAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, returnRevisions)
+}
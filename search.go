@@ -0,0 +1,86 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"strings"
+
+	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/google/uuid"
+)
+
+type SearchResult struct {
+	Post
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet,omitempty"`
+}
+
+// safeSnippet escapes the chirp text of a ts_headline snippet while keeping
+// the <mark> tags the query wrapped around the matched words.
+func safeSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, "&lt;mark&gt;", "<mark>")
+	escaped = strings.ReplaceAll(escaped, "&lt;/mark&gt;", "</mark>")
+	return escaped
+}
+
+func (cfg *apiConfig) handleSearchPosts(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Chirps []SearchResult `json:"chirps"`
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	if query == "" {
+		respondWithError(w, http.StatusBadRequest, "ERROR missing search query", nil)
+		return
+	}
+
+	limit, err := parsePageLimit(r.URL.Query().Get("limit"))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR invalid limit", err)
+		return
+	}
+
+	params := database.SearchPostsParams{
+		Highlight: r.URL.Query().Get("highlight") == "true",
+		Query:     query,
+		PageLimit: int32(limit),
+	}
+
+	if authorID := r.URL.Query().Get("author_id"); authorID != "" {
+		authorUUID, err := uuid.Parse(authorID)
+
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "ERROR  couldn't parse author_id", err)
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: authorUUID, Valid: true}
+	}
+
+	rows, err := cfg.dbQueries.SearchPosts(r.Context(), params)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR Couldn't search posts", err)
+		return
+	}
+
+	results := []SearchResult{}
+
+	for _, row := range rows {
+		results = append(results, SearchResult{
+			Post: Post{
+				ID:        row.ID,
+				CreatedAt: row.CreatedAt,
+				UpdatedAt: row.UpdatedAt,
+				Body:      row.Body,
+				UserID:    row.UserID,
+			},
+			Rank:    row.Rank,
+			Snippet: safeSnippet(row.Snippet),
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, response{Chirps: results})
+}
@@ -0,0 +1,12 @@
+package main
+
+import "testing"
+
+func TestSafeSnippet(t *testing.T) {
+	got := safeSnippet(`<script>x</script> a <mark>chirp</mark> & more`)
+	want := `&lt;script&gt;x&lt;/script&gt; a <mark>chirp</mark> &amp; more`
+
+	if got != want {
+		t.Errorf("safeSnippet() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// runServer serves until ctx is cancelled and then gives in-flight requests
+// up to drainTimeout to finish before the connections are closed
+func runServer(ctx context.Context, server *http.Server, drainTimeout time.Duration) error {
+	listener, err := net.Listen("tcp", server.Addr)
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Listening on %s", listener.Addr())
+
+	return serveUntilDone(ctx, server, listener, drainTimeout)
+}
+
+func serveUntilDone(ctx context.Context, server *http.Server, listener net.Listener, drainTimeout time.Duration) error {
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %v for open requests", drainTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+
+	if err != nil {
+		server.Close()
+		return err
+	}
+
+	err = <-serveErr
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
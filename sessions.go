@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/google/uuid"
+)
+
+const maxUserAgentLength = 512
+
+// Session is one signed in device. Its ID is the family ID shared by every
+// refresh token rotated from the same login.
+type Session struct {
+	ID              uuid.UUID `json:"id"`
+	UserAgent       string    `json:"user_agent"`
+	IPAddress       string    `json:"ip_address"`
+	SignedInAt      time.Time `json:"signed_in_at"`
+	LastRefreshedAt time.Time `json:"last_refreshed_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	Current         bool      `json:"current"`
+}
+
+// userAgent is the User-Agent header, cut to maxUserAgentLength bytes. It
+// ends up in a TEXT column, so it has to stay valid UTF-8.
+func userAgent(r *http.Request) string {
+	agent := strings.ToValidUTF8(r.UserAgent(), "")
+
+	if len(agent) > maxUserAgentLength {
+		cut := maxUserAgentLength
+
+		// Don't split a multi-byte character
+		for cut > 0 && !utf8.RuneStart(agent[cut]) {
+			cut--
+		}
+		agent = agent[:cut]
+	}
+
+	return agent
+}
+
+// revokeOtherSessions signs the user out everywhere except the session the
+// access token was issued for. Tokens from before sessions existed carry no
+// session ID, then every session is revoked.
+func revokeOtherSessions(ctx context.Context, queries *database.Queries, userID uuid.UUID, claims *auth.Claims) error {
+	sessionID, err := uuid.Parse(claims.SessionID)
+
+	if err != nil {
+		return queries.RevokeAllUserSessions(ctx, userID)
+	}
+
+	return queries.RevokeOtherUserSessions(ctx, database.RevokeOtherUserSessionsParams{
+		UserID:   userID,
+		FamilyID: sessionID,
+	})
+}
+
+func (cfg *apiConfig) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, claims, err := cfg.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+		return
+	}
+
+	rows, err := cfg.dbQueries.ListActiveSessions(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't get sessions", err)
+		return
+	}
+
+	sessions := []Session{}
+
+	for _, row := range rows {
+		sessions = append(sessions, Session{
+			ID:              row.FamilyID,
+			UserAgent:       row.UserAgent,
+			IPAddress:       row.IpAddress,
+			SignedInAt:      row.SignedInAt,
+			LastRefreshedAt: row.LastRefreshedAt,
+			ExpiresAt:       row.ExpiresAt,
+			Current:         row.FamilyID.String() == claims.SessionID,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+func (cfg *apiConfig) handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, _, err := cfg.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "ERROR  couldn't parse session ID", err)
+		return
+	}
+
+	// Scoping the update to the user means a session ID of somebody else
+	// looks the same as one that doesn't exist
+	result, err := cfg.dbQueries.RevokeUserSession(r.Context(), database.RevokeUserSessionParams{
+		FamilyID: sessionID,
+		UserID:   userID,
+	})
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR COULDN'T REVOKE SESSION", err)
+		return
+	}
+
+	revoked, err := result.RowsAffected()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR COULDN'T REVOKE SESSION", err)
+		return
+	}
+
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "ERROR couldn't find the session", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	userID, _, err := cfg.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	err = queries.RevokeAllUserSessions(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR COULDN'T REVOKE SESSIONS", err)
+		return
+	}
+
+	// Revoking the refresh tokens alone would leave the access tokens
+	// working until they expire
+	version, err := queries.BumpUserTokenVersion(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR COULDN'T REVOKE SESSIONS", err)
+		return
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR COULDN'T REVOKE SESSIONS", err)
+		return
+	}
+
+	cfg.tokenVersions.Set(userID, version)
+
+	w.WriteHeader(http.StatusNoContent)
+}
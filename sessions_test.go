@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestUserAgent(t *testing.T) {
+	tests := []struct {
+		name  string
+		agent string
+		want  int
+	}{
+		{"short", "curl/8.0", len("curl/8.0")},
+		{"ascii", strings.Repeat("a", 600), maxUserAgentLength},
+		// 511 bytes of ASCII, then a 3 byte character across the limit
+		{"multi-byte at the limit", strings.Repeat("a", 511) + "€€", 511},
+		{"invalid UTF-8", "agent\xff", len("agent")},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", tt.agent)
+
+		got := userAgent(r)
+
+		if len(got) != tt.want || !utf8.ValidString(got) {
+			t.Errorf("%s: userAgent() = %d bytes, valid %v, want %d bytes", tt.name, len(got), utf8.ValidString(got), tt.want)
+		}
+	}
+}
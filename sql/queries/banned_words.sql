@@ -0,0 +1,3 @@
+-- name: ListBannedWords :many
+SELECT * FROM banned_words
+ORDER BY word ASC;
\ No newline at end of file
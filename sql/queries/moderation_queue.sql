@@ -0,0 +1,44 @@
+-- name: EnqueuePost :one
+-- report_count starts at 0, CountModerationReport adds each reporter
+INSERT INTO moderation_queue (id, created_at, updated_at, post_id, source, reason, reporter_id, report_count, status, hidden)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    0,
+    'pending',
+    $5
+)
+ON CONFLICT (post_id) WHERE status = 'pending'
+DO UPDATE SET hidden = moderation_queue.hidden OR EXCLUDED.hidden, updated_at = NOW()
+RETURNING *;
+
+-- name: AddModerationReport :execrows
+INSERT INTO moderation_reports (item_id, reporter_id, reason, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (item_id, reporter_id) DO NOTHING;
+
+-- name: CountModerationReport :exec
+-- Called once per new reporter, the chirp is hidden when they reach hide_after
+UPDATE moderation_queue
+SET report_count = report_count + 1,
+    hidden = hidden OR report_count + 1 >= sqlc.arg('hide_after')::integer,
+    updated_at = NOW()
+WHERE id = sqlc.arg('id');
+
+-- name: ListModerationItems :many
+SELECT moderation_queue.*, posts.body AS post_body, posts.user_id AS post_user_id
+FROM moderation_queue
+JOIN posts ON posts.id = moderation_queue.post_id
+WHERE moderation_queue.status = $1
+ORDER BY moderation_queue.created_at ASC;
+
+-- name: ResolveModerationItem :one
+UPDATE moderation_queue
+SET status = $1, resolved_at = NOW(), updated_at = NOW()
+WHERE id = $2 AND status = 'pending'
+RETURNING *;
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- name: CreatePostRevision :one
+INSERT INTO post_revisions (id, post_id, body, created_at, revised_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetPostRevisions :many
+SELECT * FROM post_revisions
+WHERE post_id = $1
+ORDER BY revised_at ASC;
\ No newline at end of file
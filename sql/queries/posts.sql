@@ -7,24 +7,154 @@ VALUES (
     $1,
     $2
 )
-RETURNING *;
+RETURNING id, created_at, updated_at, body, user_id;
 
 -- name: DeletePosts :exec
 DELETE FROM posts;
 
 -- name: GetPosts :many
-SELECT * FROM posts
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: GetUserPosts :many
-SELECT * FROM posts
+SELECT id, created_at, updated_at, body, user_id FROM posts
 WHERE user_id = $1
+AND deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: GetPost :one
-SELECT * FROM posts
-WHERE $1 = id;
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE $1 = id AND deleted_at IS NULL;
+
+-- name: GetVisiblePost :one
+-- GetPost without the chirps that are hidden until reviewed
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE id = $1 AND deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+);
+
+-- name: GetPostForUpdate :one
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE id = $1 AND deleted_at IS NULL
+FOR UPDATE;
+
+-- name: UpdatePost :one
+UPDATE posts
+SET body = $1, updated_at = NOW()
+WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id;
 
 -- name: DeletePost :execresult
+UPDATE posts
+SET deleted_at = NOW()
+WHERE $1 = id AND user_id = $2 AND deleted_at IS NULL;
+
+-- name: ListPostsByCreatedAtAsc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('cursor_id')::uuid IS NULL OR (created_at, id) > (sqlc.narg('cursor_time')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListPostsByCreatedAtDesc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('cursor_id')::uuid IS NULL OR (created_at, id) < (sqlc.narg('cursor_time')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListPostsByLengthAsc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('cursor_id')::uuid IS NULL OR (char_length(body), id) > (sqlc.narg('cursor_length')::int, sqlc.narg('cursor_id')::uuid))
+ORDER BY char_length(body) ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListPostsByLengthDesc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('cursor_id')::uuid IS NULL OR (char_length(body), id) < (sqlc.narg('cursor_length')::int, sqlc.narg('cursor_id')::uuid))
+ORDER BY char_length(body) DESC, id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListPostsByUpdatedAtAsc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('cursor_id')::uuid IS NULL OR (updated_at, id) > (sqlc.narg('cursor_time')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY updated_at ASC, id ASC
+LIMIT sqlc.arg('page_limit');
+
+-- name: ListPostsByUpdatedAtDesc :many
+SELECT id, created_at, updated_at, body, user_id FROM posts
+WHERE deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND (sqlc.narg('author_id')::uuid IS NULL OR user_id = sqlc.narg('author_id')::uuid)
+AND (sqlc.narg('cursor_id')::uuid IS NULL OR (updated_at, id) < (sqlc.narg('cursor_time')::timestamp, sqlc.narg('cursor_id')::uuid))
+ORDER BY updated_at DESC, id DESC
+LIMIT sqlc.arg('page_limit');
+
+-- name: RemovePost :execresult
+UPDATE posts
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestorePost :execresult
+UPDATE posts
+SET deleted_at = NULL
+WHERE id = $1 AND deleted_at IS NOT NULL;
+
+-- name: PurgeDeletedPosts :execrows
+-- The cutoff is computed with the same clock that wrote deleted_at
 DELETE FROM posts
-WHERE $1 = id AND user_id = $2;
\ No newline at end of file
+WHERE deleted_at IS NOT NULL
+AND deleted_at < NOW() - make_interval(secs => sqlc.arg('retention_seconds')::float8);
+
+-- name: SearchPosts :many
+SELECT
+    posts.id, posts.created_at, posts.updated_at, posts.body, posts.user_id,
+    ts_rank(posts.search_vector, query)::real AS rank,
+    CASE WHEN sqlc.arg('highlight')::boolean
+        THEN ts_headline('english', posts.body, query, 'StartSel=<mark>, StopSel=</mark>, MaxFragments=2')
+        ELSE ''
+    END::text AS snippet
+FROM posts, websearch_to_tsquery('english', sqlc.arg('query')::text) AS query
+WHERE posts.search_vector @@ query
+AND posts.deleted_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM moderation_queue
+    WHERE moderation_queue.post_id = posts.id AND moderation_queue.status = 'pending' AND moderation_queue.hidden
+)
+AND (sqlc.narg('author_id')::uuid IS NULL OR posts.user_id = sqlc.narg('author_id')::uuid)
+ORDER BY rank DESC, posts.created_at DESC, posts.id DESC
+LIMIT sqlc.arg('page_limit');
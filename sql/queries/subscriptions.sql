@@ -0,0 +1,34 @@
+-- name: GetSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: UpsertSubscription :exec
+INSERT INTO subscriptions (user_id, status, current_period_end, last_event_at, created_at, updated_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW(),
+    NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET status = EXCLUDED.status,
+    current_period_end = EXCLUDED.current_period_end,
+    last_event_at = EXCLUDED.last_event_at,
+    updated_at = NOW();
+
+-- name: ExpireSubscriptions :execrows
+-- Ends every subscription whose period is over and takes Chirpy Red away
+-- from its user, returns the number of users downgraded. The end is
+-- compared with the database clock, like every other expiry
+WITH expired AS (
+    UPDATE subscriptions
+    SET status = 'expired', updated_at = NOW()
+    WHERE status <> 'expired' AND current_period_end <= NOW()
+    RETURNING user_id
+)
+UPDATE users
+SET is_chirpy_red = FALSE, updated_at = NOW()
+FROM expired
+WHERE users.id = expired.user_id;
@@ -0,0 +1,42 @@
+-- name: StartTOTPEnrollment :one
+-- Replaces an unconfirmed secret, a confirmed one has to be disabled first
+INSERT INTO totp_credentials (user_id, secret, created_at)
+VALUES (
+    $1,
+    $2,
+    NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+WHERE totp_credentials.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetTOTPCredential :one
+SELECT * FROM totp_credentials
+WHERE user_id = $1;
+
+-- name: ConfirmTOTPCredential :exec
+UPDATE totp_credentials
+SET confirmed_at = NOW(), last_used_step = $2
+WHERE user_id = $1;
+
+-- name: UseTOTPStep :execrows
+UPDATE totp_credentials
+SET last_used_step = $2
+WHERE user_id = $1
+AND last_used_step < $2;
+
+-- name: DeleteTOTPCredential :exec
+DELETE FROM totp_credentials
+WHERE user_id = $1;
+
+-- name: ListPlaintextTOTPSecrets :many
+-- Secrets stored before they were encrypted
+SELECT user_id, secret FROM totp_credentials
+WHERE secret NOT LIKE 'v1:%';
+
+-- name: SealTOTPSecret :execrows
+UPDATE totp_credentials
+SET secret = sqlc.arg(sealed)
+WHERE user_id = sqlc.arg(user_id)
+AND secret = sqlc.arg(plaintext);
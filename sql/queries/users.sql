@@ -16,13 +16,60 @@ DELETE FROM users;
 SELECT * FROM users
 WHERE email = $1;
 
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUserByIDForUpdate :one
+SELECT * FROM users
+WHERE id = $1
+FOR UPDATE;
+
 -- name: UpdateUserPasswordAndEmail :one
 UPDATE users
-SET hashed_password = $1, email = $2, updated_at = NOW()
+SET hashed_password = $1,
+    email = $2,
+    updated_at = NOW(),
+    token_version = token_version + 1,
+    -- A new address has to be verified again
+    email_verified_at = CASE WHEN email = $2 THEN email_verified_at ELSE NULL END
 WHERE id = $3
 RETURNING *;
 
 -- name: UpgradeUser :execresult
 UPDATE users
 SET is_chirpy_red = $1
-WHERE id = $2;
\ No newline at end of file
+WHERE id = $2;
+
+-- name: SetUserRoleByEmail :execresult
+UPDATE users
+SET role = $1, updated_at = NOW()
+WHERE email = $2;
+
+-- name: GetUserTokenVersion :one
+SELECT token_version FROM users
+WHERE id = $1;
+
+-- name: BumpUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = $1
+RETURNING token_version;
+
+-- name: VerifyUserEmail :execrows
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1
+AND email = $2;
+
+-- name: ResetUserPassword :one
+UPDATE users
+SET hashed_password = $1, updated_at = NOW(), token_version = token_version + 1
+WHERE id = $2
+RETURNING token_version;
+
+-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = sqlc.arg(new_hash)
+WHERE id = sqlc.arg(id)
+AND hashed_password = sqlc.arg(old_hash);
\ No newline at end of file
@@ -0,0 +1,46 @@
+-- name: ClaimWebhookEvent :one
+-- Records a delivery. Deliveries with an event_id seen before return no
+-- rows, unless they failed or their processing was abandoned, then they
+-- are processed again. Deliveries without an event_id are always new.
+INSERT INTO webhook_events (id, event_id, event_type, payload, received_at, status, claimed_at)
+VALUES (
+    gen_random_uuid(),
+    sqlc.narg('event_id'),
+    sqlc.arg('event_type'),
+    sqlc.arg('payload'),
+    NOW(),
+    'pending',
+    NOW()
+)
+ON CONFLICT (event_id) DO UPDATE
+SET status = 'pending', error = NULL, attempts = webhook_events.attempts + 1, claimed_at = NOW()
+WHERE webhook_events.status = 'failed'
+OR (webhook_events.status = 'pending' AND webhook_events.claimed_at < NOW() - make_interval(secs => sqlc.arg('claim_timeout_seconds')::float8))
+RETURNING id, received_at;
+
+-- name: FinishWebhookEvent :exec
+UPDATE webhook_events
+SET status = $1, error = $2, processed_at = NOW()
+WHERE id = $3;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE id = $1;
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE status = $1
+ORDER BY received_at DESC
+LIMIT $2;
+
+-- name: RetryWebhookEvent :one
+-- Claims a failed event again, or a pending one whose processing was
+-- abandoned
+UPDATE webhook_events
+SET status = 'pending', error = NULL, attempts = attempts + 1, claimed_at = NOW()
+WHERE id = sqlc.arg('id')
+AND (
+    status = 'failed'
+    OR (status = 'pending' AND claimed_at < NOW() - make_interval(secs => sqlc.arg('claim_timeout_seconds')::float8))
+)
+RETURNING *;
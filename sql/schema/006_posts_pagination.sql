@@ -0,0 +1,7 @@
+-- +goose Up
+CREATE INDEX posts_created_at_id_idx ON posts (created_at, id);
+CREATE INDEX posts_user_id_created_at_id_idx ON posts (user_id, created_at, id);
+
+-- +goose Down
+DROP INDEX posts_user_id_created_at_id_idx;
+DROP INDEX posts_created_at_id_idx;
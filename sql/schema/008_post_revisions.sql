@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE post_revisions(
+    id UUID PRIMARY KEY,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    revised_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX post_revisions_post_id_idx ON post_revisions (post_id, revised_at);
+
+-- +goose Down
+DROP TABLE post_revisions;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE banned_words(
+    word TEXT PRIMARY KEY,
+    action TEXT NOT NULL DEFAULT 'replace' CHECK (action IN ('replace', 'reject', 'flag')),
+    replacement TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO banned_words (word) VALUES ('kerfuffle'), ('sharbert'), ('fornax');
+
+-- +goose Down
+DROP TABLE banned_words;
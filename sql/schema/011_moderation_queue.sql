@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE moderation_queue(
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    source TEXT NOT NULL CHECK (source IN ('filter', 'report')),
+    reason TEXT NOT NULL,
+    reporter_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    report_count INTEGER NOT NULL DEFAULT 1,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'removed')),
+    resolved_at TIMESTAMP
+);
+
+-- A chirp is queued at most once while it waits for review
+CREATE UNIQUE INDEX moderation_queue_pending_post_idx ON moderation_queue (post_id) WHERE status = 'pending';
+CREATE INDEX moderation_queue_status_idx ON moderation_queue (status, created_at);
+
+-- +goose Down
+DROP TABLE moderation_queue;
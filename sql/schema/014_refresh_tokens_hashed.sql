@@ -0,0 +1,13 @@
+-- +goose Up
+-- Only SHA-256 digests are stored from now on. The plaintext tokens can't be
+-- told apart from digests, so every existing session has to log in again.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+-- +goose Down
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
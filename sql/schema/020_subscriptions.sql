@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE subscriptions(
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    -- active, cancelled (red until the period ends) or expired
+    status TEXT NOT NULL,
+    -- NULL when Polka didn't send an end, the subscription then runs until
+    -- it is downgraded
+    current_period_end TIMESTAMP,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX subscriptions_current_period_end_idx ON subscriptions (current_period_end)
+WHERE status <> 'expired';
+
+-- Users upgraded before subscriptions were tracked stay red
+INSERT INTO subscriptions (user_id, status, current_period_end, created_at, updated_at)
+SELECT id, 'active', NULL, NOW(), NOW()
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
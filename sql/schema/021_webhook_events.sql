@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE webhook_events(
+    id UUID PRIMARY KEY,
+    -- The ID Polka gives the event, the same on every retry of a delivery
+    event_id TEXT NOT NULL UNIQUE,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    -- pending, processed, ignored or failed
+    status TEXT NOT NULL,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    processed_at TIMESTAMP
+);
+
+CREATE INDEX webhook_events_status_received_at_idx ON webhook_events (status, received_at);
+
+-- +goose Down
+DROP TABLE webhook_events;
@@ -0,0 +1,12 @@
+-- +goose Up
+-- One index per sort key of GET /api/chirps, created_at has one since 006
+CREATE INDEX posts_updated_at_id_idx ON posts (updated_at, id);
+CREATE INDEX posts_user_id_updated_at_id_idx ON posts (user_id, updated_at, id);
+CREATE INDEX posts_length_id_idx ON posts ((char_length(body)), id);
+CREATE INDEX posts_user_id_length_id_idx ON posts (user_id, (char_length(body)), id);
+
+-- +goose Down
+DROP INDEX posts_user_id_length_id_idx;
+DROP INDEX posts_length_id_idx;
+DROP INDEX posts_user_id_updated_at_id_idx;
+DROP INDEX posts_updated_at_id_idx;
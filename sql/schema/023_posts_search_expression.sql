@@ -0,0 +1,15 @@
+-- +goose Up
+-- Every SELECT * on posts read the stored tsvector, an expression index
+-- keeps search fast without the column
+DROP INDEX posts_search_vector_idx;
+ALTER TABLE posts DROP COLUMN search_vector;
+
+CREATE INDEX posts_body_search_idx ON posts USING GIN (to_tsvector('english', body));
+
+-- +goose Down
+DROP INDEX posts_body_search_idx;
+
+ALTER TABLE posts
+ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+
+CREATE INDEX posts_search_vector_idx ON posts USING GIN (search_vector);
@@ -0,0 +1,7 @@
+-- +goose Up
+-- When the last applied Polka event happened, older events arriving late
+-- or replayed are ignored
+ALTER TABLE subscriptions ADD COLUMN last_event_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE subscriptions DROP COLUMN last_event_at;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Only IDs Polka sends deduplicate deliveries, deliveries without one are
+-- all processed. The payload hashes used before are dropped.
+ALTER TABLE webhook_events ALTER COLUMN event_id DROP NOT NULL;
+UPDATE webhook_events SET event_id = NULL WHERE event_id LIKE 'sha256:%';
+
+-- When processing last started, a pending event claimed too long ago was
+-- abandoned and can be claimed again
+ALTER TABLE webhook_events ADD COLUMN claimed_at TIMESTAMP;
+UPDATE webhook_events SET claimed_at = received_at;
+ALTER TABLE webhook_events ALTER COLUMN claimed_at SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE webhook_events DROP COLUMN claimed_at;
+UPDATE webhook_events SET event_id = 'delivery:' || id WHERE event_id IS NULL;
+ALTER TABLE webhook_events ALTER COLUMN event_id SET NOT NULL;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Back to the stored tsvector of 007, post queries list their columns
+-- so they don't read it
+DROP INDEX posts_body_search_idx;
+
+ALTER TABLE posts
+ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+
+CREATE INDEX posts_search_vector_idx ON posts USING GIN (search_vector);
+
+-- +goose Down
+DROP INDEX posts_search_vector_idx;
+ALTER TABLE posts DROP COLUMN search_vector;
+
+CREATE INDEX posts_body_search_idx ON posts USING GIN (to_tsvector('english', body));
@@ -0,0 +1,25 @@
+-- +goose Up
+-- One row per user who reported a queued chirp, so report_count counts
+-- reporters instead of reports
+CREATE TABLE moderation_reports(
+    item_id UUID NOT NULL REFERENCES moderation_queue(id) ON DELETE CASCADE,
+    reporter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (item_id, reporter_id)
+);
+
+INSERT INTO moderation_reports (item_id, reporter_id, reason, created_at)
+SELECT id, reporter_id, reason, created_at FROM moderation_queue
+WHERE source = 'report' AND reporter_id IS NOT NULL;
+
+-- Pending chirps are only hidden once the filter flagged them or enough
+-- users reported them
+ALTER TABLE moderation_queue
+ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE moderation_queue SET hidden = true WHERE source = 'filter';
+
+-- +goose Down
+ALTER TABLE moderation_queue DROP COLUMN hidden;
+DROP TABLE moderation_reports;
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/FallenL3vi/WebServer/internal/auth"
+	"github.com/FallenL3vi/WebServer/internal/database"
+	"github.com/FallenL3vi/WebServer/internal/mailer"
+)
+
+const maxEmailLength = 254
+
+// validateEmail accepts a bare address such as jane@example.com, display
+// names and comments are rejected
+func validateEmail(email string) error {
+	if email == "" {
+		return errors.New("email is required")
+	}
+
+	if len(email) > maxEmailLength {
+		return fmt.Errorf("email can't be longer than %d characters", maxEmailLength)
+	}
+
+	address, err := mail.ParseAddress(email)
+
+	if err != nil || address.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		return errors.New("email is not a valid address")
+	}
+
+	return nil
+}
+
+// createVerificationToken replaces any earlier token of the user, only the
+// link of the latest email works
+func (cfg *apiConfig) createVerificationToken(ctx context.Context, queries *database.Queries, user database.User) (string, error) {
+	err := queries.DeleteEmailVerificationTokens(ctx, user.ID)
+
+	if err != nil {
+		return "", err
+	}
+
+	token, err := auth.MakeToken()
+
+	if err != nil {
+		return "", err
+	}
+
+	err = queries.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: time.Now().UTC().Add(cfg.emailVerificationTTL),
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func (cfg *apiConfig) sendVerificationEmail(ctx context.Context, email, token string) error {
+	link := strings.TrimSuffix(cfg.publicURL, "/") + "/api/users/verify?token=" + url.QueryEscape(token)
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Verify your Chirpy email address",
+		Body: "Open this link to verify your email address and start chirping:\n\n" +
+			link + "\n\n" +
+			"The link works once and expires in " + cfg.emailVerificationTTL.String() + ".\n",
+	})
+}
+
+func (cfg *apiConfig) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+
+	token := r.URL.Query().Get("token")
+
+	if token == "" {
+		respondWithError(w, http.StatusBadRequest, "ERROR missing verification token", nil)
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+
+	queries := cfg.dbQueries.WithTx(tx)
+
+	verification, err := queries.ConsumeEmailVerificationToken(r.Context(), auth.HashToken(token))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusBadRequest, "ERROR verification link is invalid or expired", err)
+		return
+	}
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't verify the email", err)
+		return
+	}
+
+	// The token belongs to the address it was sent to, it can't verify an
+	// address the user switched to afterwards
+	verified, err := queries.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:    verification.UserID,
+		Email: verification.Email,
+	})
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't verify the email", err)
+		return
+	}
+
+	if verified == 0 {
+		respondWithError(w, http.StatusBadRequest, "ERROR verification link is invalid or expired", nil)
+		return
+	}
+
+	err = tx.Commit()
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't verify the email", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{Email: verification.Email, EmailVerified: true})
+}
+
+func (cfg *apiConfig) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, _, err := cfg.authenticate(r)
+
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "ERROR WRONG JWT ACCESS DENIED", err)
+		return
+	}
+
+	user, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error couldn't get the user", err)
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		respondWithError(w, http.StatusConflict, "ERROR email is already verified", nil)
+		return
+	}
+
+	token, err := cfg.createVerificationToken(r.Context(), cfg.dbQueries, user)
+
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "ERROR couldn't create verification token", err)
+		return
+	}
+
+	err = cfg.sendVerificationEmail(r.Context(), user.Email, token)
+
+	if err != nil {
+		respondWithError(w, http.StatusBadGateway, "ERROR couldn't send the verification email", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FallenL3vi/WebServer/internal/mailer"
+)
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		email   string
+		wantErr bool
+	}{
+		{"jane@example.com", false},
+		{"jane.doe+chirpy@mail.example.org", false},
+		{"", true},
+		{"jane", true},
+		{"jane@localhost", true},
+		{"Jane <jane@example.com>", true},
+		{"jane@example.com\r\nBcc: eve@example.com", true},
+		{strings.Repeat("a", 250) + "@example.com", true},
+	}
+
+	for _, tt := range tests {
+		err := validateEmail(tt.email)
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateEmail(%q) error = %v, wantErr %v", tt.email, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSendVerificationEmail(t *testing.T) {
+	dir := t.TempDir()
+	cfg := apiConfig{
+		mailer:    &mailer.FileMailer{Dir: dir, From: "chirpy@example.com"},
+		publicURL: "https://chirpy.example.com/",
+	}
+
+	err := cfg.sendVerificationEmail(context.Background(), "jane@example.com", "abc123")
+
+	if err != nil {
+		t.Fatalf("sendVerificationEmail() error = %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+
+	if len(files) != 1 {
+		t.Fatalf("FileMailer wrote %d files, want 1", len(files))
+	}
+
+	data, _ := os.ReadFile(files[0])
+
+	for _, want := range []string{"To: jane@example.com", "From: chirpy@example.com", "https://chirpy.example.com/api/users/verify?token=abc123"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("email doesn't contain %q:\n%s", want, data)
+		}
+	}
+}